@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/thealonlevi/subnet-sentinel/internal/checker"
+	"github.com/thealonlevi/subnet-sentinel/internal/config"
+	"github.com/thealonlevi/subnet-sentinel/internal/logging"
+	"github.com/thealonlevi/subnet-sentinel/internal/subnets"
+)
+
+const pluginName = "SUBNET-SENTINEL"
+
+func executeCheck(ctx context.Context, cfg config.Config, subs []subnets.Subnet, logger logging.Logger, w io.Writer) error {
+	chk, err := checker.New(cfg, subs, newHTTPClient(cfg), logger)
+	if err != nil {
+		return err
+	}
+	results, err := chk.Run(ctx)
+	if err != nil {
+		return err
+	}
+	eval := checker.Evaluate(results, cfg.Thresholds)
+	printPluginOutput(w, eval, len(results), cfg.Thresholds)
+	if eval.Status == checker.StatusOK {
+		return nil
+	}
+	return exitError{code: int(eval.Status)}
+}
+
+func printPluginOutput(w io.Writer, eval checker.Evaluation, probes int, thresholds config.ThresholdsConfig) {
+	healthy := 0
+	for _, summary := range eval.Summaries {
+		if summary.Failed == 0 {
+			healthy++
+		}
+	}
+	detail := fmt.Sprintf("%d/%d subnets healthy, %d probes", healthy, len(eval.Summaries), probes)
+	if len(eval.Reasons) > 0 {
+		detail = strings.Join(eval.Reasons, ", ")
+	}
+	fmt.Fprintf(w, "%s %s - %s | %s\n", pluginName, eval.Status, detail, pluginPerfdata(eval.Summaries, thresholds))
+	for _, summary := range eval.Summaries {
+		for _, res := range summary.Failures {
+			fmt.Fprintf(w, "%s %s %s: %s\n", summary.Subnet, res.SourceIP, res.URL, checker.FailureReason(res))
+		}
+	}
+}
+
+func pluginPerfdata(summaries []checker.SubnetSummary, thresholds config.ThresholdsConfig) string {
+	warning, critical := "", ""
+	if thresholds.WarningPercent != nil {
+		warning = fmt.Sprintf("%g:", *thresholds.WarningPercent)
+	}
+	if thresholds.CriticalPercent != nil {
+		critical = fmt.Sprintf("%g:", *thresholds.CriticalPercent)
+	}
+	fields := make([]string, 0, len(summaries)*3)
+	for _, summary := range summaries {
+		p50, p95 := "U", "U"
+		if summary.Succeeded > 0 {
+			p50 = fmt.Sprintf("%.3fs", summary.P50.Seconds())
+			p95 = fmt.Sprintf("%.3fs", summary.P95.Seconds())
+		}
+		fields = append(fields,
+			fmt.Sprintf("'%s success'=%.1f%%;%s;%s;0;100", summary.Subnet, summary.SuccessRatio()*100, warning, critical),
+			fmt.Sprintf("'%s p50'=%s;;;0", summary.Subnet, p50),
+			fmt.Sprintf("'%s p95'=%s;;;0", summary.Subnet, p95),
+		)
+	}
+	return strings.Join(fields, " ")
+}
+
+func pluginUnknown(w io.Writer, err error) error {
+	if err == nil {
+		return nil
+	}
+	var exit exitError
+	if errors.As(err, &exit) {
+		return err
+	}
+	message := strings.ReplaceAll(err.Error(), "|", "/")
+	fmt.Fprintf(w, "%s %s - %s\n", pluginName, checker.StatusUnknown, strings.ReplaceAll(message, "\n", " "))
+	return exitError{code: int(checker.StatusUnknown)}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/thealonlevi/subnet-sentinel/internal/checker"
+	"github.com/thealonlevi/subnet-sentinel/internal/config"
+)
+
+func TestPrintPluginOutput(t *testing.T) {
+	percent := func(v float64) *float64 { return &v }
+	ms := func(n int) time.Duration { return time.Duration(n) * time.Millisecond }
+	healthy := []checker.Result{
+		{Subnet: "10.0.0.0/24", SourceIP: "10.0.0.1", URL: "https://a.test", Success: true, StatusCode: 200, Duration: ms(40)},
+		{Subnet: "10.0.0.0/24", SourceIP: "10.0.0.2", URL: "https://a.test", Success: true, StatusCode: 200, Duration: ms(20)},
+	}
+	degraded := append(append([]checker.Result(nil), healthy...),
+		checker.Result{Subnet: "10.0.0.0/24", SourceIP: "10.0.0.3", URL: "https://a.test", StatusCode: 502},
+		checker.Result{Subnet: "10.1.0.0/24", SourceIP: "10.1.0.1", URL: "https://a.test", Error: "timeout"},
+	)
+	cases := []struct {
+		name       string
+		results    []checker.Result
+		thresholds config.ThresholdsConfig
+		expected   string
+	}{
+		{
+			name:       "ok",
+			results:    healthy,
+			thresholds: config.ThresholdsConfig{WarningPercent: percent(100), CriticalPercent: percent(0)},
+			expected: "SUBNET-SENTINEL OK - 1/1 subnets healthy, 2 probes | " +
+				"'10.0.0.0/24 success'=100.0%;100:;0:;0;100 '10.0.0.0/24 p50'=0.020s;;;0 '10.0.0.0/24 p95'=0.040s;;;0\n",
+		},
+		{
+			name:       "critical with failures",
+			results:    degraded,
+			thresholds: config.ThresholdsConfig{WarningPercent: percent(90), CriticalPercent: percent(50)},
+			expected: "SUBNET-SENTINEL CRITICAL - 10.0.0.0/24 success 66.7% below 90%, 10.1.0.0/24 success 0.0% below 50% | " +
+				"'10.0.0.0/24 success'=66.7%;90:;50:;0;100 '10.0.0.0/24 p50'=0.020s;;;0 '10.0.0.0/24 p95'=0.040s;;;0 " +
+				"'10.1.0.0/24 success'=0.0%;90:;50:;0;100 '10.1.0.0/24 p50'=U;;;0 '10.1.0.0/24 p95'=U;;;0\n" +
+				"10.0.0.0/24 10.0.0.3 https://a.test: status 502\n" +
+				"10.1.0.0/24 10.1.0.1 https://a.test: timeout\n",
+		},
+		{
+			name:       "no thresholds",
+			results:    healthy[:1],
+			thresholds: config.ThresholdsConfig{},
+			expected: "SUBNET-SENTINEL OK - 1/1 subnets healthy, 1 probes | " +
+				"'10.0.0.0/24 success'=100.0%;;;0;100 '10.0.0.0/24 p50'=0.040s;;;0 '10.0.0.0/24 p95'=0.040s;;;0\n",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			printPluginOutput(&buf, checker.Evaluate(tc.results, tc.thresholds), len(tc.results), tc.thresholds)
+			if buf.String() != tc.expected {
+				t.Fatalf("unexpected output\n got: %q\nwant: %q", buf.String(), tc.expected)
+			}
+		})
+	}
+}
+
+func TestPluginUnknown(t *testing.T) {
+	cases := []struct {
+		name     string
+		err      error
+		expected string
+		code     int
+	}{
+		{name: "nil", err: nil},
+		{name: "error", err: fmt.Errorf("read config: open a|b\nmissing"), expected: "SUBNET-SENTINEL UNKNOWN - read config: open a/b missing\n", code: 3},
+		{name: "status", err: exitError{code: 2}, code: 2},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			err := pluginUnknown(&buf, tc.err)
+			if buf.String() != tc.expected {
+				t.Fatalf("unexpected output %q", buf.String())
+			}
+			var exit exitError
+			if tc.code == 0 {
+				if err != nil {
+					t.Fatalf("expected no error, got %v", err)
+				}
+			} else if !errors.As(err, &exit) || exit.code != tc.code {
+				t.Fatalf("expected exit code %d, got %v", tc.code, err)
+			}
+		})
+	}
+}
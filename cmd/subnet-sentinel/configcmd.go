@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/thealonlevi/subnet-sentinel/internal/config"
+	"github.com/thealonlevi/subnet-sentinel/internal/statefile"
+	"github.com/thealonlevi/subnet-sentinel/internal/validate"
+)
+
+func executeConfig(cfg config.Config, args []string) error {
+	action := "show"
+	if len(args) > 0 {
+		action = strings.ToLower(args[0])
+	}
+	switch action {
+	case "show":
+		encoder := yaml.NewEncoder(os.Stdout)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(cfg); err != nil {
+			return fmt.Errorf("encode config: %w", err)
+		}
+		return encoder.Close()
+	default:
+		return fmt.Errorf("unknown config action %s", action)
+	}
+}
+
+type validateOutput struct {
+	Valid       bool                `json:"valid"`
+	Errors      int                 `json:"errors"`
+	Warnings    int                 `json:"warnings"`
+	Diagnostics []config.Diagnostic `json:"diagnostics"`
+}
+
+func executeValidate(ld loader, asJSON bool) error {
+	path := ld.path
+	diags := validate.Run(path, ld.options())
+	errorCount := diags.Count(config.SeverityError)
+	warningCount := diags.Count(config.SeverityWarning)
+	if asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		output := validateOutput{
+			Valid:       errorCount == 0,
+			Errors:      errorCount,
+			Warnings:    warningCount,
+			Diagnostics: append([]config.Diagnostic{}, diags.Items...),
+		}
+		if err := encoder.Encode(output); err != nil {
+			return fmt.Errorf("encode diagnostics: %w", err)
+		}
+	} else {
+		for _, item := range diags.Items {
+			fmt.Println(item.String())
+		}
+		fmt.Printf("%s: %d errors, %d warnings\n", path, errorCount, warningCount)
+	}
+	if errorCount > 0 {
+		return fmt.Errorf("config %s is invalid", path)
+	}
+	return nil
+}
+
+func executeConvert(ld loader, args []string) error {
+	flags := flag.NewFlagSet("config convert", flag.ContinueOnError)
+	to := flags.String("to", "", "")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *to == "" {
+		return fmt.Errorf("config convert requires --to yaml, json or toml")
+	}
+	return config.Convert(ld.path, ld.format, *to, os.Stdout)
+}
+
+func executeMigrate(ld loader, args []string) error {
+	flags := flag.NewFlagSet("config migrate", flag.ContinueOnError)
+	dryRun := flags.Bool("dry-run", false, "")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	data, from, err := config.Migrate(ld.path, ld.format)
+	if err != nil {
+		return err
+	}
+	if *dryRun {
+		_, err := os.Stdout.Write(data)
+		return err
+	}
+	if from == config.CurrentVersion {
+		fmt.Printf("%s is already at config version %d\n", ld.path, from)
+		return nil
+	}
+	if err := statefile.WriteAtomic(ld.path, data); err != nil {
+		return err
+	}
+	fmt.Printf("migrated %s from config version %d to %d\n", ld.path, from, config.CurrentVersion)
+	return nil
+}
+
+func executeSchema() error {
+	data, err := config.Schema()
+	if err != nil {
+		return fmt.Errorf("generate schema: %w", err)
+	}
+	_, err = os.Stdout.Write(data)
+	return err
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/thealonlevi/subnet-sentinel/internal/checker"
+	"github.com/thealonlevi/subnet-sentinel/internal/statefile"
+	"github.com/thealonlevi/subnet-sentinel/internal/subnets"
+)
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Skipped  int              `xml:"skipped,attr"`
+	Time     string           `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name       string          `xml:"name,attr"`
+	Tests      int             `xml:"tests,attr"`
+	Failures   int             `xml:"failures,attr"`
+	Errors     int             `xml:"errors,attr"`
+	Skipped    int             `xml:"skipped,attr"`
+	Time       string          `xml:"time,attr"`
+	Timestamp  string          `xml:"timestamp,attr"`
+	Properties []junitProperty `xml:"properties>property,omitempty"`
+	Cases      []junitTestCase `xml:"testcase"`
+}
+
+type junitProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Skipped   *junitSkipped `xml:"skipped,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Details string `xml:",cdata"`
+}
+
+type junitSkipped struct {
+	Message string `xml:"message,attr"`
+}
+
+func writeJUnitReport(path string, run runRecord) error {
+	data, err := junitReport(run)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("create junit report directory: %w", err)
+	}
+	return statefile.WriteAtomic(path, data)
+}
+
+func junitReport(run runRecord) ([]byte, error) {
+	report := run.Report
+	suites := junitTestSuites{Name: "subnet-sentinel", Time: junitSeconds(report.End.Sub(report.Start))}
+	index := make(map[string]int)
+	durations := make([]time.Duration, 0)
+	for _, res := range report.Results {
+		i, ok := index[res.Subnet]
+		if !ok {
+			i = len(suites.Suites)
+			index[res.Subnet] = i
+			durations = append(durations, 0)
+			suites.Suites = append(suites.Suites, junitTestSuite{
+				Name:       res.Subnet,
+				Timestamp:  report.Start.UTC().Format("2006-01-02T15:04:05"),
+				Properties: junitProperties(run, res.Tags),
+			})
+		}
+		suite := &suites.Suites[i]
+		testCase := junitTestCase{
+			Name:      res.SourceIP + " " + res.URL,
+			Classname: res.Subnet,
+			Time:      junitSeconds(res.Duration),
+		}
+		if res.Drilldown {
+			testCase.Name += " (drilldown)"
+		}
+		switch {
+		case res.Quarantined:
+			testCase.Skipped = &junitSkipped{Message: "quarantined re-test: " + resultOutcome(res)}
+			suite.Skipped++
+		case !res.Success:
+			testCase.Failure = junitFailureFor(res)
+			suite.Failures++
+		}
+		suite.Tests++
+		suite.Cases = append(suite.Cases, testCase)
+		durations[i] += res.Duration
+	}
+	for i := range suites.Suites {
+		suite := &suites.Suites[i]
+		suite.Time = junitSeconds(durations[i])
+		suites.Tests += suite.Tests
+		suites.Failures += suite.Failures
+		suites.Skipped += suite.Skipped
+	}
+	data, err := xml.MarshalIndent(suites, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("encode junit report: %w", err)
+	}
+	return append([]byte(xml.Header), append(data, '\n')...), nil
+}
+
+func junitProperties(run runRecord, tags map[string]string) []junitProperty {
+	properties := []junitProperty{
+		{Name: "runId", Value: strconv.Itoa(run.RunID)},
+		{Name: "seed", Value: strconv.FormatInt(run.Report.Seed, 10)},
+		{Name: "configHash", Value: run.ConfigHash},
+	}
+	keys := make([]string, 0, len(tags))
+	for key := range tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		properties = append(properties, junitProperty{Name: "tag." + key, Value: tags[key]})
+	}
+	return properties
+}
+
+func junitFailureFor(res checker.Result) *junitFailure {
+	failureType := "error"
+	if res.Error == "" && res.StatusCode != 0 {
+		failureType = "status"
+	}
+	details := []string{
+		"subnet: " + res.Subnet,
+		"source ip: " + res.SourceIP,
+		"url: " + res.URL,
+		"duration: " + res.Duration.Truncate(time.Millisecond).String(),
+	}
+	if res.StatusCode != 0 {
+		details = append(details, "status: "+strconv.Itoa(res.StatusCode))
+	}
+	if res.Error != "" {
+		details = append(details, "error: "+res.Error)
+	}
+	if len(res.Tags) > 0 {
+		details = append(details, "tags: "+subnets.FormatTags(res.Tags))
+	}
+	return &junitFailure{
+		Message: checker.FailureReason(res),
+		Type:    failureType,
+		Details: strings.Join(details, "\n"),
+	}
+}
+
+func resultOutcome(res checker.Result) string {
+	if res.Success {
+		return fmt.Sprintf("status %d", res.StatusCode)
+	}
+	return checker.FailureReason(res)
+}
+
+func junitSeconds(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', 3, 64)
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"encoding/xml"
+	"testing"
+)
+
+func TestJUnitReportRoundTrips(t *testing.T) {
+	run := testRunRecord()
+	run.Report.Results = append(run.Report.Results, run.Report.Results[0])
+	run.Report.Results[2].Subnet = "10.1.0.0/24"
+	run.Report.Results[2].Quarantined = true
+	data, err := junitReport(run)
+	if err != nil {
+		t.Fatalf("report: %v", err)
+	}
+	var suites junitTestSuites
+	if err := xml.Unmarshal(data, &suites); err != nil {
+		t.Fatalf("decode: %v\n%s", err, data)
+	}
+	if suites.Tests != 3 || suites.Failures != 1 || suites.Skipped != 1 || suites.Time != "1.500" {
+		t.Fatalf("unexpected totals %+v", suites)
+	}
+	if len(suites.Suites) != 2 {
+		t.Fatalf("expected one suite per subnet, got %d", len(suites.Suites))
+	}
+	first, second := suites.Suites[0], suites.Suites[1]
+	if first.Name != "10.0.0.0/24" || first.Tests != 2 || first.Failures != 1 || first.Time != "1.012" {
+		t.Fatalf("unexpected first suite %+v", first)
+	}
+	if second.Name != "10.1.0.0/24" || second.Skipped != 1 || second.Time != "0.013" {
+		t.Fatalf("unexpected second suite %+v", second)
+	}
+	failed := first.Cases[1]
+	if failed.Name != "10.0.0.9 https://a.test (drilldown)" || failed.Failure == nil || failed.Failure.Message != "dial tcp: timeout" {
+		t.Fatalf("unexpected failed case %+v", failed)
+	}
+	if failed.Failure.Details != "subnet: 10.0.0.0/24\nsource ip: 10.0.0.9\nurl: https://a.test\nduration: 1s\nerror: dial tcp: timeout\ntags: customer=acme" {
+		t.Fatalf("unexpected failure details %q", failed.Failure.Details)
+	}
+	if second.Cases[0].Skipped == nil || second.Cases[0].Skipped.Message != "quarantined re-test: status 200" {
+		t.Fatalf("unexpected skipped case %+v", second.Cases[0])
+	}
+	if len(first.Properties) != 4 || first.Properties[3].Name != "tag.customer" {
+		t.Fatalf("unexpected properties %+v", first.Properties)
+	}
+}
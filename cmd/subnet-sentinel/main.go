@@ -5,130 +5,601 @@ import (
 	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"os"
 	"os/signal"
+	"reflect"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
 
 	"github.com/thealonlevi/subnet-sentinel/internal/checker"
 	"github.com/thealonlevi/subnet-sentinel/internal/config"
+	"github.com/thealonlevi/subnet-sentinel/internal/coverage"
 	"github.com/thealonlevi/subnet-sentinel/internal/httpclient"
 	"github.com/thealonlevi/subnet-sentinel/internal/logging"
+	"github.com/thealonlevi/subnet-sentinel/internal/metrics"
 	"github.com/thealonlevi/subnet-sentinel/internal/mount"
+	"github.com/thealonlevi/subnet-sentinel/internal/quarantine"
 	"github.com/thealonlevi/subnet-sentinel/internal/subnets"
 )
 
+const configWatchInterval = 5 * time.Second
+
 func main() {
-	if err := run(); err != nil {
-		fmt.Fprintf(os.Stderr, "error: %v\n", err)
-		os.Exit(1)
+	err := run()
+	if err == nil {
+		return
+	}
+	var exit exitError
+	if errors.As(err, &exit) {
+		if exit.message != "" {
+			fmt.Fprintln(os.Stderr, exit.message)
+		}
+		os.Exit(exit.code)
 	}
+	fmt.Fprintf(os.Stderr, "error: %v\n", err)
+	os.Exit(1)
 }
 
-func run() error {
+func run() (err error) {
 	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer cancel()
-	var configPath string
-	var logLevel string
-	flags := flag.NewFlagSet("subnet-sentinel", flag.ContinueOnError)
-	flags.StringVar(&configPath, "config", "", "")
-	flags.StringVar(&configPath, "c", "", "")
-	flags.StringVar(&logLevel, "log-level", "info", "")
+	opts := globalOptions{overrides: make(map[string]string)}
+	flags := newFlagSet("subnet-sentinel", &opts, nil)
 	if err := flags.Parse(os.Args[1:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
 		return err
 	}
-	if configPath == "" {
+	args := flags.Args()
+	command := "run"
+	if len(args) > 0 {
+		command = strings.ToLower(args[0])
+		args = args[1:]
+	}
+	switch command {
+	case "once":
+		defer func() { err = asUnknown(err) }()
+	case "check":
+		defer func() { err = pluginUnknown(os.Stdout, err) }()
+	}
+	var cmdOpts commandOptions
+	cmdFlags := newFlagSet(command, &opts, &cmdOpts)
+	if err := cmdFlags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return err
+	}
+	if opts.configPath == "" {
 		if env := os.Getenv("SUBNET_SENTINEL_CONFIG"); env != "" {
-			configPath = env
+			opts.configPath = env
 		} else {
-			configPath = "config.yaml"
+			opts.configPath = "config.yaml"
 		}
 	}
-	if logLevel == "" {
-		logLevel = "info"
+	if opts.logLevel == "" {
+		opts.logLevel = "info"
 	}
-	args := flags.Args()
-	command := "run"
-	if len(args) > 0 {
-		command = strings.ToLower(args[0])
+	if opts.logFormat == "" {
+		opts.logFormat = os.Getenv("SUBNET_SENTINEL_LOG_FORMAT")
+	}
+	if opts.configFormat == "" {
+		opts.configFormat = os.Getenv("SUBNET_SENTINEL_CONFIG_FORMAT")
+	}
+	if env := os.Getenv("SUBNET_SENTINEL_ALLOW_UNKNOWN_KEYS"); env != "" && !opts.allowUnknown {
+		parsed, err := strconv.ParseBool(env)
+		if err != nil {
+			return fmt.Errorf("invalid SUBNET_SENTINEL_ALLOW_UNKNOWN_KEYS %q", env)
+		}
+		opts.allowUnknown = parsed
+	}
+	ld := loader{
+		path:         opts.configPath,
+		format:       opts.configFormat,
+		overrides:    opts.overrides,
+		tags:         cmdOpts.tags,
+		allowUnknown: opts.allowUnknown,
+	}
+	if command == "validate" {
+		return executeValidate(ld, cmdOpts.jsonOutput)
 	}
-	cfg, err := config.Load(configPath)
+	if command == "config" && len(cmdFlags.Args()) > 0 {
+		switch cmdFlags.Arg(0) {
+		case "convert":
+			return executeConvert(ld, cmdFlags.Args()[1:])
+		case "migrate":
+			return executeMigrate(ld, cmdFlags.Args()[1:])
+		case "schema":
+			return executeSchema()
+		}
+	}
+	output, err := newRunWriter(cmdOpts.outputFormat, os.Stdout)
 	if err != nil {
 		return err
 	}
-	logger, err := logging.New(logLevel)
+	cfg, subnetDefs, err := ld.load()
 	if err != nil {
 		return err
 	}
-	subnetDefs, err := subnets.FromConfigs(cfg.Subnets)
+	var logWriter io.Writer = os.Stdout
+	if output.format != outputText || command == "check" {
+		logWriter = os.Stderr
+	}
+	logger, err := newLogger(cfg.Logging, opts, logWriter)
 	if err != nil {
 		return err
 	}
+	defer logger.Close()
 	switch command {
 	case "run":
-		return executeRunLoop(ctx, cfg, subnetDefs, logger)
+		return executeRunLoop(ctx, ld, cfg, subnetDefs, logger, output, cmdOpts.watchConfig)
 	case "once":
-		return executeOnce(ctx, cfg, subnetDefs, logger)
+		return executeOnce(ctx, cfg, subnetDefs, logger, output, cmdOpts.junitPath)
+	case "check":
+		return executeCheck(ctx, cfg, subnetDefs, logger, os.Stdout)
+	case "sweep":
+		return executeSweep(ctx, cfg, subnetDefs, logger, cmdOpts.sweep)
+	case "coverage":
+		return executeCoverage(cfg, subnetDefs, cmdOpts.coverageWindow)
+	case "quarantine":
+		return executeQuarantine(cfg, cmdFlags.Args())
+	case "config":
+		return executeConfig(cfg, cmdFlags.Args())
 	case "check-mount":
-		return executeCheckMount(ctx, cfg.DefaultInterface, subnetDefs)
+		return executeCheckMount(ctx, cfg.Mount.DefaultInterface, subnetDefs)
 	case "mount":
 		return executeMount()
 	case "":
-		return executeRunLoop(ctx, cfg, subnetDefs, logger)
+		return executeRunLoop(ctx, ld, cfg, subnetDefs, logger, output, cmdOpts.watchConfig)
 	default:
 		return fmt.Errorf("unknown command %s", command)
 	}
 }
 
-func executeRunLoop(ctx context.Context, cfg config.Config, subs []subnets.Subnet, logger logging.Logger) error {
-	client := httpclient.New(15 * time.Second)
-	chk, err := checker.New(cfg, subs, client, logger)
+type globalOptions struct {
+	configPath   string
+	configFormat string
+	logLevel     string
+	logFormat    string
+	allowUnknown bool
+	overrides    map[string]string
+}
+
+type loader struct {
+	path         string
+	format       string
+	overrides    map[string]string
+	tags         []string
+	allowUnknown bool
+}
+
+func (l loader) options() config.LoadOptions {
+	return config.LoadOptions{
+		Environ:          os.Environ(),
+		Overrides:        l.overrides,
+		AllowUnknownKeys: l.allowUnknown,
+		Format:           l.format,
+		Warn: func(message string) {
+			fmt.Fprintf(os.Stderr, "warning: %s\n", message)
+		},
+	}
+}
+
+func (l loader) load() (config.Config, []subnets.Subnet, error) {
+	cfg, err := config.LoadWithOptions(l.path, l.options())
+	if err != nil {
+		return config.Config{}, nil, err
+	}
+	subnetDefs, err := subnets.FromConfigs(cfg.Subnets)
+	if err != nil {
+		return config.Config{}, nil, err
+	}
+	if len(l.tags) > 0 {
+		selector, err := parseTagSelectors(l.tags)
+		if err != nil {
+			return config.Config{}, nil, err
+		}
+		subnetDefs = subnets.FilterByTags(subnetDefs, selector)
+		if len(subnetDefs) == 0 {
+			return config.Config{}, nil, fmt.Errorf("no subnets match tags %s", subnets.FormatTags(selector))
+		}
+	}
+	return cfg, subnetDefs, nil
+}
+
+type commandOptions struct {
+	sweep          sweepOptions
+	coverageWindow time.Duration
+	tags           stringList
+	watchConfig    bool
+	jsonOutput     bool
+	outputFormat   string
+	junitPath      string
+}
+
+func newFlagSet(name string, opts *globalOptions, cmd *commandOptions) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.StringVar(&opts.configPath, "config", opts.configPath, "")
+	flags.StringVar(&opts.configPath, "c", opts.configPath, "")
+	flags.StringVar(&opts.configFormat, "config-format", opts.configFormat, "")
+	flags.StringVar(&opts.logLevel, "log-level", opts.logLevel, "")
+	flags.StringVar(&opts.logFormat, "log-format", opts.logFormat, "")
+	flags.BoolVar(&opts.allowUnknown, "allow-unknown-keys", opts.allowUnknown, "")
+	if cmd != nil {
+		addCommandFlags(flags, name, cmd)
+	}
+	for _, field := range config.ScalarFields() {
+		if flags.Lookup(field.Flag) != nil {
+			continue
+		}
+		value := &overrideFlag{path: field.Path, values: opts.overrides, isBool: field.Kind == reflect.Bool}
+		flags.Var(value, field.Flag, "overrides "+field.Path+" ("+field.Env+")")
+	}
+	for _, field := range config.DeprecatedFields() {
+		if flags.Lookup(field.Flag) != nil {
+			continue
+		}
+		replacement := config.Replacement(field).Flag
+		value := &overrideFlag{path: field.Path, values: opts.overrides, isBool: field.Kind == reflect.Bool, deprecated: field.Flag, replacement: replacement}
+		flags.Var(value, field.Flag, "deprecated, use --"+replacement)
+	}
+	return flags
+}
+
+func addCommandFlags(flags *flag.FlagSet, command string, cmd *commandOptions) {
+	if command == "run" || command == "once" || command == "check" || command == "" {
+		flags.Var(&cmd.tags, "tag", "")
+	}
+	if command == "run" || command == "once" || command == "" {
+		flags.StringVar(&cmd.outputFormat, "output", outputText, "")
+	}
+	if command == "once" {
+		flags.StringVar(&cmd.junitPath, "junit", "", "")
+	}
+	if command == "run" || command == "" {
+		flags.BoolVar(&cmd.watchConfig, "watch-config", false, "")
+	}
+	if command == "sweep" {
+		flags.StringVar(&cmd.sweep.CIDR, "cidr", "", "")
+		flags.Float64Var(&cmd.sweep.Rate, "rate", 10, "")
+		flags.IntVar(&cmd.sweep.Concurrency, "concurrency", 32, "")
+		flags.IntVar(&cmd.sweep.BlockPrefix, "block", 28, "")
+		flags.Var(&cmd.sweep.Excludes, "exclude", "")
+		flags.Var(&cmd.sweep.Targets, "target", "")
+	}
+	if command == "coverage" {
+		flags.DurationVar(&cmd.coverageWindow, "window", 0, "")
+	}
+	if command == "validate" {
+		flags.BoolVar(&cmd.jsonOutput, "json", false, "")
+	}
+}
+
+type overrideFlag struct {
+	path        string
+	values      map[string]string
+	isBool      bool
+	deprecated  string
+	replacement string
+}
+
+func (f *overrideFlag) String() string {
+	if f == nil || f.values == nil {
+		return ""
+	}
+	return f.values[f.path]
+}
+
+func (f *overrideFlag) Set(value string) error {
+	if f.deprecated != "" {
+		fmt.Fprintf(os.Stderr, "warning: --%s is deprecated, use --%s\n", f.deprecated, f.replacement)
+	}
+	f.values[f.path] = value
+	return nil
+}
+
+func (f *overrideFlag) IsBoolFlag() bool {
+	return f.isBool
+}
+
+func parseTagSelectors(values []string) (map[string]string, error) {
+	selector := make(map[string]string, len(values))
+	for _, value := range values {
+		key, tagValue, ok := strings.Cut(value, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid tag selector %s, expected key=value", value)
+		}
+		selector[key] = strings.TrimSpace(tagValue)
+	}
+	return selector, nil
+}
+
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			*l = append(*l, item)
+		}
+	}
+	return nil
+}
+
+func executeRunLoop(ctx context.Context, ld loader, cfg config.Config, subs []subnets.Subnet, logger logging.Logger, output *runWriter, watch bool) error {
+	chk, err := checker.New(cfg, subs, newHTTPClient(cfg), logger)
 	if err != nil {
 		return err
 	}
-	interval := time.Duration(cfg.IntervalSeconds) * time.Second
-	if interval < 0 {
-		interval = 0
+	reload := make(chan string, 1)
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-hup:
+				requestReload(reload, "SIGHUP")
+			}
+		}
+	}()
+	if watch {
+		go watchConfigFile(ctx, ld.path, reload)
+	}
+	var registry *metrics.Registry
+	if cfg.Metrics.Listen != "" {
+		registry = metrics.New()
+		if err := serveMetrics(ctx, cfg.Metrics.Listen, registry, logger); err != nil {
+			return err
+		}
 	}
+	next := make(map[string]time.Time, len(subs))
 	runID := 1
 	for {
-		start := time.Now()
-		results, err := chk.Run(ctx)
-		if err != nil {
-			return ensureRunErrorHandled(err)
+		select {
+		case reason := <-reload:
+			cfg, subs = reloadConfig(ld, chk, cfg, subs, logger, reason)
+		default:
 		}
-		printSummary(runID, results)
-		runID++
-		if interval == 0 {
-			continue
+		now := time.Now()
+		due := make([]int, 0, len(subs))
+		wake := time.Time{}
+		for i, subnet := range subs {
+			if !next[subnet.CIDR].After(now) {
+				due = append(due, i)
+			} else if wake.IsZero() || next[subnet.CIDR].Before(wake) {
+				wake = next[subnet.CIDR]
+			}
 		}
-		elapsed := time.Since(start)
-		sleep := interval - elapsed
-		if sleep > 0 {
+		if len(due) == 0 {
 			select {
 			case <-ctx.Done():
 				return ensureRunErrorHandled(ctx.Err())
-			case <-time.After(sleep):
+			case reason := <-reload:
+				cfg, subs = reloadConfig(ld, chk, cfg, subs, logger, reason)
+			case <-time.After(time.Until(wake)):
 			}
+			continue
+		}
+		var report checker.Report
+		if cfg.Seed != nil {
+			report, err = chk.ExecuteSubnets(ctx, *cfg.Seed+int64(runID-1), due)
+		} else {
+			var seed int64
+			seed, err = subnets.RandomSeed()
+			if err != nil {
+				return err
+			}
+			report, err = chk.ExecuteSubnets(ctx, seed, due)
+		}
+		if err != nil {
+			return ensureRunErrorHandled(err)
+		}
+		if registry != nil {
+			cidrs := make([]string, 0, len(subs))
+			for _, subnet := range subs {
+				cidrs = append(cidrs, subnet.CIDR)
+			}
+			registry.Retain(cidrs)
+			registry.Observe(report)
+		}
+		run, err := newRunRecord(chk, cfg, runID, report)
+		if err != nil {
+			return err
+		}
+		if err := output.Write(run); err != nil {
+			return err
+		}
+		for _, i := range due {
+			interval := chk.IntervalFor(subs[i])
+			if interval < 0 {
+				interval = 0
+			}
+			next[subs[i].CIDR] = report.Start.Add(interval)
+		}
+		runID++
+	}
+}
+
+func newLogger(cfg config.LoggingConfig, opts globalOptions, writer io.Writer) (logging.Logger, error) {
+	return logging.NewWithOptions(logging.Options{
+		Level:   opts.logLevel,
+		Format:  opts.logFormat,
+		Writer:  writer,
+		Outputs: cfg.Outputs,
+		Tag:     cfg.Tag,
+		File: logging.FileOptions{
+			Path:       cfg.File.Path,
+			MaxSize:    int64(cfg.File.MaxSizeMB) << 20,
+			MaxAge:     time.Duration(cfg.File.MaxAgeHours) * time.Hour,
+			MaxBackups: cfg.File.MaxBackups,
+			Compress:   cfg.File.Compress,
+		},
+		Syslog: logging.SyslogOptions{
+			Network:  cfg.Syslog.Network,
+			Address:  cfg.Syslog.Address,
+			Facility: cfg.Syslog.Facility,
+		},
+	})
+}
+
+func reloadConfig(ld loader, chk *checker.Checker, cfg config.Config, subs []subnets.Subnet, logger logging.Logger, reason string) (config.Config, []subnets.Subnet) {
+	newCfg, newSubs, err := ld.load()
+	if err != nil {
+		logger.Warn("config reload failed, keeping previous config", "trigger", reason, "error", err.Error())
+		return cfg, subs
+	}
+	if err := chk.Update(newCfg, newSubs); err != nil {
+		logger.Warn("config reload failed, keeping previous config", "trigger", reason, "error", err.Error())
+		return cfg, subs
+	}
+	if newCfg.MaxTimeoutSeconds() != cfg.MaxTimeoutSeconds() {
+		chk.Client = newHTTPClient(newCfg)
+	}
+	if !reflect.DeepEqual(newCfg.Logging, cfg.Logging) {
+		logger.Warn("logging settings changed, restart to apply", "trigger", reason)
+	}
+	if newCfg.Metrics != cfg.Metrics {
+		logger.Warn("metrics settings changed, restart to apply", "trigger", reason)
+	}
+	logger.Info("config reloaded", "trigger", reason, "subnets", len(newSubs))
+	return newCfg, newSubs
+}
+
+func requestReload(reload chan string, reason string) {
+	select {
+	case reload <- reason:
+	default:
+	}
+}
+
+func watchConfigFile(ctx context.Context, path string, reload chan string) {
+	last, _ := os.Stat(path)
+	ticker := time.NewTicker(configWatchInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		if last == nil || !info.ModTime().Equal(last.ModTime()) || info.Size() != last.Size() {
+			last = info
+			requestReload(reload, "file-change")
 		}
 	}
 }
 
-func executeOnce(ctx context.Context, cfg config.Config, subs []subnets.Subnet, logger logging.Logger) error {
-	client := httpclient.New(15 * time.Second)
-	chk, err := checker.New(cfg, subs, client, logger)
+func executeOnce(ctx context.Context, cfg config.Config, subs []subnets.Subnet, logger logging.Logger, output *runWriter, junitPath string) error {
+	chk, err := checker.New(cfg, subs, newHTTPClient(cfg), logger)
+	if err != nil {
+		return err
+	}
+	report, err := chk.Execute(ctx)
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return exitError{code: int(checker.StatusUnknown), message: "UNKNOWN: run interrupted before every subnet was checked"}
+	}
 	if err != nil {
 		return err
 	}
-	results, err := chk.Run(ctx)
+	run, err := newRunRecord(chk, cfg, 1, report)
 	if err != nil {
-		return ensureRunErrorHandled(err)
+		return err
+	}
+	if err := output.Write(run); err != nil {
+		return err
 	}
-	printSummary(1, results)
+	if junitPath != "" {
+		if err := writeJUnitReport(junitPath, run); err != nil {
+			return err
+		}
+	}
+	return statusExit(checker.Evaluate(report.Results, cfg.Thresholds))
+}
+
+func newRunRecord(chk *checker.Checker, cfg config.Config, runID int, report checker.Report) (runRecord, error) {
+	hash, err := cfg.Hash()
+	if err != nil {
+		return runRecord{}, err
+	}
+	window := coverageWindowFor(cfg)
+	return runRecord{
+		RunID:      runID,
+		ConfigHash: hash,
+		Report:     report,
+		Coverage:   chk.CoverageReport(window),
+		Window:     window,
+	}, nil
+}
+
+func executeCoverage(cfg config.Config, subs []subnets.Subnet, window time.Duration) error {
+	if window <= 0 {
+		window = coverageWindowFor(cfg)
+	}
+	tracker, err := coverage.Load(cfg.Coverage.File)
+	if err != nil {
+		return err
+	}
+	since := time.Now().Add(-window)
+	report := make([]coverage.SubnetCoverage, 0, len(subs))
+	for _, subnet := range subs {
+		report = append(report, tracker.Coverage(subnet.CIDR, subnet.Pool, since))
+	}
+	printCoverage(os.Stdout, report, window)
 	return nil
 }
 
+func executeQuarantine(cfg config.Config, args []string) error {
+	if cfg.Quarantine.File == "" {
+		return fmt.Errorf("quarantine.file is not configured")
+	}
+	store, err := quarantine.Load(cfg.Quarantine.File, cfg.Quarantine.FailureThreshold, cfg.Quarantine.ReleaseAfter)
+	if err != nil {
+		return err
+	}
+	action := "list"
+	if len(args) > 0 {
+		action = strings.ToLower(args[0])
+		args = args[1:]
+	}
+	switch action {
+	case "list":
+		printQuarantine(store.List(), cfg.Quarantine.ReleaseAfter)
+		return nil
+	case "clear":
+		cleared := store.Clear(args...)
+		if err := store.Save(); err != nil {
+			return err
+		}
+		fmt.Printf("cleared %d quarantined ips\n", cleared)
+		return nil
+	default:
+		return fmt.Errorf("unknown quarantine action %s", action)
+	}
+}
+
+func coverageWindowFor(cfg config.Config) time.Duration {
+	return time.Duration(cfg.Coverage.WindowHours) * time.Hour
+}
+
+func newHTTPClient(cfg config.Config) *httpclient.Client {
+	return httpclient.New(time.Duration(cfg.MaxTimeoutSeconds()) * time.Second)
+}
+
 func executeCheckMount(ctx context.Context, defaultInterface string, subs []subnets.Subnet) error {
 	requests := mount.PrepareRequests(defaultInterface, subs)
 	statuses, err := mount.Check(ctx, requests)
@@ -154,22 +625,10 @@ func ensureRunErrorHandled(err error) error {
 	return err
 }
 
-func printSummary(runID int, results []checker.Result) {
-	timestamp := time.Now().Format(time.RFC3339)
-	fmt.Printf("RUN %d %s total=%d\n", runID, timestamp, len(results))
-	for _, res := range results {
-		status := "OK"
-		detail := fmt.Sprintf("status=%d", res.StatusCode)
-		if !res.Success {
-			status = "FAIL"
-			if res.Error != "" {
-				detail = res.Error
-			} else {
-				detail = "error"
-			}
-		}
-		duration := res.Duration.Truncate(time.Millisecond)
-		fmt.Printf("%s subnet=%s ip=%s url=%s duration=%s %s\n", status, res.Subnet, res.SourceIP, res.URL, duration.String(), detail)
+func printQuarantine(entries []quarantine.Entry, releaseAfter int) {
+	fmt.Printf("QUARANTINE %s total=%d\n", time.Now().Format(time.RFC3339), len(entries))
+	for _, entry := range entries {
+		fmt.Printf("subnet=%s ip=%s since=%s last_tested=%s successes=%d/%d reason=%s\n", entry.Subnet, entry.IP, entry.Since.Format(time.RFC3339), entry.LastTested.Format(time.RFC3339), entry.Successes, releaseAfter, entry.Reason)
 	}
 }
 
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/thealonlevi/subnet-sentinel/internal/checker"
+	"github.com/thealonlevi/subnet-sentinel/internal/config"
+	"github.com/thealonlevi/subnet-sentinel/internal/logging"
+)
+
+func TestNewFlagSetRegistersOverridesForEveryCommand(t *testing.T) {
+	commands := []string{"", "run", "once", "check", "sweep", "coverage", "quarantine", "config", "validate", "mount"}
+	for _, command := range commands {
+		opts := globalOptions{overrides: make(map[string]string)}
+		var cmdOpts commandOptions
+		flags := newFlagSet(command, &opts, &cmdOpts)
+		for _, field := range append(config.ScalarFields(), config.DeprecatedFields()...) {
+			if flags.Lookup(field.Flag) == nil {
+				t.Fatalf("command %q: missing flag --%s", command, field.Flag)
+			}
+		}
+		if command == "once" {
+			if _, ok := flags.Lookup("output").Value.(*overrideFlag); ok {
+				t.Fatalf("--output must not be shadowed by a config override")
+			}
+		}
+	}
+}
+
+func TestNewFlagSetParsesOverridesAndHelp(t *testing.T) {
+	opts := globalOptions{overrides: make(map[string]string)}
+	var cmdOpts commandOptions
+	flags := newFlagSet("once", &opts, &cmdOpts)
+	flags.SetOutput(io.Discard)
+	if err := flags.Parse([]string{"--ips-per-subnet", "3", "--output", "json"}); err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if opts.overrides["ipsPerSubnet"] != "3" || cmdOpts.outputFormat != "json" {
+		t.Fatalf("unexpected values: %v %q", opts.overrides, cmdOpts.outputFormat)
+	}
+	if err := flags.Parse([]string{"--help"}); !errors.Is(err, flag.ErrHelp) {
+		t.Fatalf("expected flag.ErrHelp, got %v", err)
+	}
+}
+
+func TestReloadConfigKeepsClientWhenUpdateFails(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	ld := loader{path: path}
+	if err := os.WriteFile(path, []byte("subnets:\n  - cidr: 10.0.0.0/24\ntargets: [https://a.test]\n"), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	cfg, subs, err := ld.load()
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	logger, err := logging.New("error")
+	if err != nil {
+		t.Fatalf("logger init: %v", err)
+	}
+	client := newHTTPClient(cfg)
+	chk, err := checker.New(cfg, subs, client, logger)
+	if err != nil {
+		t.Fatalf("checker init: %v", err)
+	}
+	coverageFile := filepath.Join(dir, "coverage.json")
+	if err := os.WriteFile(coverageFile, []byte("not json"), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := os.WriteFile(path, []byte("subnets:\n  - cidr: 10.0.0.0/24\ntargets: [https://a.test]\ntimeoutSeconds: 30\ncoverage:\n  file: "+coverageFile+"\n"), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	kept, _ := reloadConfig(ld, chk, cfg, subs, logger, "test")
+	if kept.TimeoutSeconds != cfg.TimeoutSeconds || chk.Client != client {
+		t.Fatalf("expected the previous config and client to be kept, got timeout %d", kept.TimeoutSeconds)
+	}
+}
@@ -0,0 +1,421 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/thealonlevi/subnet-sentinel/internal/checker"
+	"github.com/thealonlevi/subnet-sentinel/internal/coverage"
+	"github.com/thealonlevi/subnet-sentinel/internal/subnets"
+)
+
+const (
+	outputText   = "text"
+	outputJSON   = "json"
+	outputNDJSON = "ndjson"
+	outputCSV    = "csv"
+	outputTable  = "table"
+)
+
+const (
+	colorReset  = "\x1b[0m"
+	colorBold   = "\x1b[1m"
+	colorRed    = "\x1b[31m"
+	colorGreen  = "\x1b[32m"
+	colorYellow = "\x1b[33m"
+	colorDim    = "\x1b[2m"
+)
+
+type runRecord struct {
+	RunID      int
+	ConfigHash string
+	Report     checker.Report
+	Coverage   []coverage.SubnetCoverage
+	Window     time.Duration
+}
+
+type runHeader struct {
+	Type       string    `json:"type,omitempty"`
+	RunID      int       `json:"runId"`
+	Seed       int64     `json:"seed"`
+	Start      time.Time `json:"start"`
+	End        time.Time `json:"end"`
+	ConfigHash string    `json:"configHash"`
+	Total      int       `json:"total"`
+	Failed     int       `json:"failed"`
+}
+
+type resultRecord struct {
+	Type        string            `json:"type,omitempty"`
+	RunID       int               `json:"runId,omitempty"`
+	Subnet      string            `json:"subnet"`
+	SourceIP    string            `json:"sourceIp"`
+	URL         string            `json:"url"`
+	Success     bool              `json:"success"`
+	StatusCode  int               `json:"statusCode"`
+	DurationMS  float64           `json:"durationMs"`
+	Error       string            `json:"error,omitempty"`
+	Drilldown   bool              `json:"drilldown"`
+	Quarantined bool              `json:"quarantined"`
+	Tags        map[string]string `json:"tags,omitempty"`
+}
+
+type blockRecord struct {
+	Type    string            `json:"type,omitempty"`
+	RunID   int               `json:"runId,omitempty"`
+	Subnet  string            `json:"subnet"`
+	Block   string            `json:"block"`
+	Hosts   int               `json:"hosts"`
+	Failed  int               `json:"failed"`
+	Verdict string            `json:"verdict"`
+	Tags    map[string]string `json:"tags,omitempty"`
+}
+
+type coverageRecord struct {
+	Type    string  `json:"type,omitempty"`
+	RunID   int     `json:"runId,omitempty"`
+	Subnet  string  `json:"subnet"`
+	Window  string  `json:"window"`
+	Hosts   int     `json:"hosts"`
+	Covered int     `json:"covered"`
+	Percent float64 `json:"percent"`
+}
+
+type runDocument struct {
+	Run      runHeader        `json:"run"`
+	Results  []resultRecord   `json:"results"`
+	Blocks   []blockRecord    `json:"blocks"`
+	Coverage []coverageRecord `json:"coverage"`
+}
+
+var csvColumns = []string{
+	"run_id", "seed", "run_start", "run_end", "config_hash",
+	"subnet", "source_ip", "url", "success", "status_code", "duration_ms",
+	"error", "drilldown", "quarantined", "tags",
+}
+
+type runWriter struct {
+	format      string
+	w           io.Writer
+	color       bool
+	wroteHeader bool
+}
+
+func newRunWriter(format string, w io.Writer) (*runWriter, error) {
+	format = strings.ToLower(strings.TrimSpace(format))
+	switch format {
+	case "":
+		format = outputText
+	case outputText, outputJSON, outputNDJSON, outputCSV, outputTable:
+	default:
+		return nil, fmt.Errorf("invalid output format %s, expected text, table, json, ndjson or csv", format)
+	}
+	return &runWriter{format: format, w: w, color: useColor(w)}, nil
+}
+
+func (rw *runWriter) Write(run runRecord) error {
+	switch rw.format {
+	case outputJSON:
+		return rw.writeJSON(run)
+	case outputNDJSON:
+		return rw.writeNDJSON(run)
+	case outputCSV:
+		return rw.writeCSV(run)
+	case outputTable:
+		return rw.writeTable(run)
+	default:
+		printSummary(rw.w, run.RunID, run.Report.Seed, run.Report.Results)
+		printBlockVerdicts(rw.w, run.Report.Blocks)
+		printCoverage(rw.w, run.Coverage, run.Window)
+		return nil
+	}
+}
+
+func (rw *runWriter) writeJSON(run runRecord) error {
+	doc := runDocument{
+		Run:      newRunHeader(run),
+		Results:  make([]resultRecord, 0, len(run.Report.Results)),
+		Blocks:   make([]blockRecord, 0, len(run.Report.Blocks)),
+		Coverage: make([]coverageRecord, 0, len(run.Coverage)),
+	}
+	for _, res := range run.Report.Results {
+		doc.Results = append(doc.Results, newResultRecord(res))
+	}
+	for _, block := range run.Report.Blocks {
+		doc.Blocks = append(doc.Blocks, newBlockRecord(block))
+	}
+	for _, cov := range run.Coverage {
+		doc.Coverage = append(doc.Coverage, newCoverageRecord(cov, run.Window))
+	}
+	encoder := json.NewEncoder(rw.w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(doc)
+}
+
+func (rw *runWriter) writeNDJSON(run runRecord) error {
+	encoder := json.NewEncoder(rw.w)
+	header := newRunHeader(run)
+	header.Type = "run"
+	if err := encoder.Encode(header); err != nil {
+		return err
+	}
+	for _, res := range run.Report.Results {
+		record := newResultRecord(res)
+		record.Type, record.RunID = "result", run.RunID
+		if err := encoder.Encode(record); err != nil {
+			return err
+		}
+	}
+	for _, block := range run.Report.Blocks {
+		record := newBlockRecord(block)
+		record.Type, record.RunID = "block", run.RunID
+		if err := encoder.Encode(record); err != nil {
+			return err
+		}
+	}
+	for _, cov := range run.Coverage {
+		record := newCoverageRecord(cov, run.Window)
+		record.Type, record.RunID = "coverage", run.RunID
+		if err := encoder.Encode(record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (rw *runWriter) writeCSV(run runRecord) error {
+	writer := csv.NewWriter(rw.w)
+	if !rw.wroteHeader {
+		if err := writer.Write(csvColumns); err != nil {
+			return err
+		}
+		rw.wroteHeader = true
+	}
+	header := newRunHeader(run)
+	for _, res := range run.Report.Results {
+		record := newResultRecord(res)
+		row := []string{
+			strconv.Itoa(header.RunID),
+			strconv.FormatInt(header.Seed, 10),
+			header.Start.Format(time.RFC3339Nano),
+			header.End.Format(time.RFC3339Nano),
+			header.ConfigHash,
+			record.Subnet,
+			record.SourceIP,
+			record.URL,
+			strconv.FormatBool(record.Success),
+			strconv.Itoa(record.StatusCode),
+			strconv.FormatFloat(record.DurationMS, 'f', 3, 64),
+			record.Error,
+			strconv.FormatBool(record.Drilldown),
+			strconv.FormatBool(record.Quarantined),
+			subnets.FormatTags(record.Tags),
+		}
+		if err := writer.Write(row); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+func (rw *runWriter) writeTable(run runRecord) error {
+	report := run.Report
+	duration := report.End.Sub(report.Start).Truncate(time.Millisecond)
+	fmt.Fprintf(rw.w, "%s  seed=%d  %s  %d probes in %s\n\n",
+		rw.paint(colorBold, fmt.Sprintf("Run %d", run.RunID)), report.Seed, report.Start.Format(time.RFC3339), len(report.Results), duration)
+	summaries := checker.Summarize(report.Results)
+	if len(summaries) == 0 {
+		fmt.Fprintln(rw.w, "no results")
+		return nil
+	}
+	header := []string{"SUBNET", "PASS", "FAIL", "QUAR", "RATIO", "P50", "P95"}
+	rows := make([][]string, 0, len(summaries))
+	for _, summary := range summaries {
+		rows = append(rows, []string{
+			summary.Subnet,
+			strconv.Itoa(summary.Succeeded),
+			strconv.Itoa(summary.Failed),
+			strconv.Itoa(summary.Quarantined),
+			fmt.Sprintf("%.1f%%", summary.SuccessRatio()*100),
+			formatLatency(summary.P50),
+			formatLatency(summary.P95),
+		})
+	}
+	widths := make([]int, len(header))
+	for _, row := range append([][]string{header}, rows...) {
+		for i, cell := range row {
+			widths[i] = max(widths[i], utf8.RuneCountInString(cell))
+		}
+	}
+	fmt.Fprintln(rw.w, rw.paint(colorBold, padRow(header, widths)))
+	blocks := make(map[string][]checker.BlockVerdict)
+	for _, block := range report.Blocks {
+		blocks[block.Subnet] = append(blocks[block.Subnet], block)
+	}
+	for i, summary := range summaries {
+		color := colorGreen
+		switch {
+		case summary.Total > 0 && summary.Succeeded == 0:
+			color = colorRed
+		case summary.Failed > 0:
+			color = colorYellow
+		}
+		fmt.Fprintln(rw.w, rw.paint(color, padRow(rows[i], widths)))
+		for _, res := range summary.Failures {
+			fmt.Fprintf(rw.w, "  %s %-15s %s  %s\n", rw.paint(colorRed, "x"), res.SourceIP, res.URL, checker.FailureReason(res))
+		}
+		for _, block := range blocks[summary.Subnet] {
+			fmt.Fprintln(rw.w, rw.paint(colorDim, fmt.Sprintf("  block %s %s, %d/%d hosts failed", block.Block, block.Verdict, block.Failed, block.Hosts)))
+		}
+	}
+	if len(run.Coverage) > 0 {
+		fmt.Fprintln(rw.w)
+		for _, cov := range run.Coverage {
+			fmt.Fprintln(rw.w, rw.paint(colorDim, fmt.Sprintf("coverage %s %.1f%% (%d/%d hosts in %s)", cov.Subnet, cov.Percent, cov.Covered, cov.Hosts, run.Window)))
+		}
+	}
+	return nil
+}
+
+func (rw *runWriter) paint(color, text string) string {
+	if !rw.color {
+		return text
+	}
+	return color + text + colorReset
+}
+
+func padRow(cells []string, widths []int) string {
+	var b strings.Builder
+	for i, cell := range cells {
+		if i > 0 {
+			b.WriteString("  ")
+		}
+		if i == len(cells)-1 {
+			b.WriteString(cell)
+			continue
+		}
+		b.WriteString(cell)
+		b.WriteString(strings.Repeat(" ", widths[i]-utf8.RuneCountInString(cell)))
+	}
+	return b.String()
+}
+
+func formatLatency(d time.Duration) string {
+	if d == 0 {
+		return "-"
+	}
+	if d < time.Millisecond {
+		return d.Round(time.Microsecond).String()
+	}
+	return d.Round(time.Millisecond).String()
+}
+
+func useColor(w io.Writer) bool {
+	if os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	file, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+func newRunHeader(run runRecord) runHeader {
+	header := runHeader{
+		RunID:      run.RunID,
+		Seed:       run.Report.Seed,
+		Start:      run.Report.Start,
+		End:        run.Report.End,
+		ConfigHash: run.ConfigHash,
+		Total:      len(run.Report.Results),
+	}
+	for _, res := range run.Report.Results {
+		if !res.Success {
+			header.Failed++
+		}
+	}
+	return header
+}
+
+func newResultRecord(res checker.Result) resultRecord {
+	return resultRecord{
+		Subnet:      res.Subnet,
+		SourceIP:    res.SourceIP,
+		URL:         res.URL,
+		Success:     res.Success,
+		StatusCode:  res.StatusCode,
+		DurationMS:  float64(res.Duration) / float64(time.Millisecond),
+		Error:       res.Error,
+		Drilldown:   res.Drilldown,
+		Quarantined: res.Quarantined,
+		Tags:        res.Tags,
+	}
+}
+
+func newBlockRecord(block checker.BlockVerdict) blockRecord {
+	return blockRecord{
+		Subnet:  block.Subnet,
+		Block:   block.Block,
+		Hosts:   block.Hosts,
+		Failed:  block.Failed,
+		Verdict: block.Verdict,
+		Tags:    block.Tags,
+	}
+}
+
+func newCoverageRecord(cov coverage.SubnetCoverage, window time.Duration) coverageRecord {
+	return coverageRecord{
+		Subnet:  cov.Subnet,
+		Window:  window.String(),
+		Hosts:   cov.Hosts,
+		Covered: cov.Covered,
+		Percent: cov.Percent,
+	}
+}
+
+func printSummary(w io.Writer, runID int, seed int64, results []checker.Result) {
+	timestamp := time.Now().Format(time.RFC3339)
+	fmt.Fprintf(w, "RUN %d %s total=%d seed=%d\n", runID, timestamp, len(results), seed)
+	for _, res := range results {
+		status := "OK"
+		detail := fmt.Sprintf("status=%d", res.StatusCode)
+		if !res.Success {
+			status = "FAIL"
+			if res.Error != "" {
+				detail = res.Error
+			} else {
+				detail = "error"
+			}
+		}
+		if res.Quarantined {
+			detail += " quarantined=yes"
+		}
+		if len(res.Tags) > 0 {
+			detail += " tags=" + subnets.FormatTags(res.Tags)
+		}
+		duration := res.Duration.Truncate(time.Millisecond)
+		fmt.Fprintf(w, "%s subnet=%s ip=%s url=%s duration=%s %s\n", status, res.Subnet, res.SourceIP, res.URL, duration.String(), detail)
+	}
+}
+
+func printBlockVerdicts(w io.Writer, blocks []checker.BlockVerdict) {
+	for _, block := range blocks {
+		fmt.Fprintf(w, "BLOCK subnet=%s block=%s verdict=%s failed=%d/%d\n", block.Subnet, block.Block, block.Verdict, block.Failed, block.Hosts)
+	}
+}
+
+func printCoverage(w io.Writer, report []coverage.SubnetCoverage, window time.Duration) {
+	for _, cov := range report {
+		fmt.Fprintf(w, "COVERAGE subnet=%s window=%s covered=%d/%d percent=%.1f\n", cov.Subnet, window.String(), cov.Covered, cov.Hosts, cov.Percent)
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/thealonlevi/subnet-sentinel/internal/checker"
+	"github.com/thealonlevi/subnet-sentinel/internal/coverage"
+)
+
+func testRunRecord() runRecord {
+	start := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	tags := map[string]string{"customer": "acme"}
+	return runRecord{
+		RunID:      3,
+		ConfigHash: "abc123",
+		Report: checker.Report{
+			Seed:  42,
+			Start: start,
+			End:   start.Add(1500 * time.Millisecond),
+			Results: []checker.Result{
+				{Subnet: "10.0.0.0/24", SourceIP: "10.0.0.7", URL: "https://a.test", Success: true, StatusCode: 200, Duration: 12500 * time.Microsecond, Tags: tags},
+				{Subnet: "10.0.0.0/24", SourceIP: "10.0.0.9", URL: "https://a.test", Duration: time.Second, Error: "dial tcp: timeout", Drilldown: true, Tags: tags},
+			},
+			Blocks: []checker.BlockVerdict{
+				{Subnet: "10.0.0.0/24", Block: "10.0.0.0/28", Hosts: 4, Failed: 1, Verdict: "partial", Tags: tags},
+			},
+		},
+		Coverage: []coverage.SubnetCoverage{{Subnet: "10.0.0.0/24", Hosts: 254, Covered: 127, Percent: 50}},
+		Window:   24 * time.Hour,
+	}
+}
+
+func writeRun(t *testing.T, format string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	rw, err := newRunWriter(format, &buf)
+	if err != nil {
+		t.Fatalf("writer: %v", err)
+	}
+	if err := rw.Write(testRunRecord()); err != nil {
+		t.Fatalf("write %s: %v", format, err)
+	}
+	return buf.Bytes()
+}
+
+func TestRunWriterJSON(t *testing.T) {
+	var doc runDocument
+	if err := json.Unmarshal(writeRun(t, outputJSON), &doc); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	run := testRunRecord()
+	expected := runHeader{RunID: 3, Seed: 42, Start: run.Report.Start, End: run.Report.End, ConfigHash: "abc123", Total: 2, Failed: 1}
+	if doc.Run != expected {
+		t.Fatalf("unexpected header %+v", doc.Run)
+	}
+	if len(doc.Results) != 2 || doc.Results[0].DurationMS != 12.5 || doc.Results[0].Tags["customer"] != "acme" {
+		t.Fatalf("unexpected results %+v", doc.Results)
+	}
+	if failed := doc.Results[1]; failed.Success || !failed.Drilldown || failed.Error != "dial tcp: timeout" {
+		t.Fatalf("unexpected failed result %+v", failed)
+	}
+	if len(doc.Blocks) != 1 || doc.Blocks[0].Verdict != "partial" {
+		t.Fatalf("unexpected blocks %+v", doc.Blocks)
+	}
+	if len(doc.Coverage) != 1 || doc.Coverage[0].Window != "24h0m0s" || doc.Coverage[0].Covered != 127 {
+		t.Fatalf("unexpected coverage %+v", doc.Coverage)
+	}
+}
+
+func TestRunWriterNDJSON(t *testing.T) {
+	lines := strings.Split(strings.TrimSpace(string(writeRun(t, outputNDJSON))), "\n")
+	types := make([]string, 0, len(lines))
+	for _, line := range lines {
+		var record map[string]any
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("decode %q: %v", line, err)
+		}
+		if record["type"] != "run" && record["runId"] != float64(3) {
+			t.Fatalf("record without run id: %s", line)
+		}
+		types = append(types, record["type"].(string))
+	}
+	if expected := []string{"run", "result", "result", "block", "coverage"}; !reflect.DeepEqual(types, expected) {
+		t.Fatalf("expected record types %v, got %v", expected, types)
+	}
+	var result resultRecord
+	if err := json.Unmarshal([]byte(lines[2]), &result); err != nil || result.SourceIP != "10.0.0.9" || result.Success {
+		t.Fatalf("unexpected result record %+v, %v", result, err)
+	}
+}
+
+func TestRunWriterCSV(t *testing.T) {
+	var buf bytes.Buffer
+	rw, err := newRunWriter(outputCSV, &buf)
+	if err != nil {
+		t.Fatalf("writer: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := rw.Write(testRunRecord()); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(rows) != 5 || !reflect.DeepEqual(rows[0], csvColumns) {
+		t.Fatalf("expected one header and four rows, got %v", rows)
+	}
+	expected := []string{
+		"3", "42", "2026-10-18T12:00:00Z", "2026-10-18T12:00:01.5Z", "abc123",
+		"10.0.0.0/24", "10.0.0.9", "https://a.test", "false", "0", "1000.000",
+		"dial tcp: timeout", "true", "false", "customer=acme",
+	}
+	if !reflect.DeepEqual(rows[2], expected) {
+		t.Fatalf("unexpected row %v", rows[2])
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/thealonlevi/subnet-sentinel/internal/checker"
+)
+
+type exitError struct {
+	code    int
+	message string
+}
+
+func (e exitError) Error() string {
+	return e.message
+}
+
+func statusExit(eval checker.Evaluation) error {
+	if eval.Status == checker.StatusOK {
+		return nil
+	}
+	return exitError{code: int(eval.Status), message: eval.Status.String() + ": " + strings.Join(eval.Reasons, ", ")}
+}
+
+func asUnknown(err error) error {
+	if err == nil {
+		return nil
+	}
+	var exit exitError
+	if errors.As(err, &exit) {
+		return err
+	}
+	return exitError{code: int(checker.StatusUnknown), message: "error: " + err.Error()}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/thealonlevi/subnet-sentinel/internal/checker"
+	"github.com/thealonlevi/subnet-sentinel/internal/config"
+	"github.com/thealonlevi/subnet-sentinel/internal/logging"
+	"github.com/thealonlevi/subnet-sentinel/internal/subnets"
+)
+
+type sweepOptions struct {
+	CIDR        string
+	Rate        float64
+	Concurrency int
+	BlockPrefix int
+	Excludes    stringList
+	Targets     stringList
+}
+
+func executeSweep(ctx context.Context, cfg config.Config, subs []subnets.Subnet, logger logging.Logger, opts sweepOptions) error {
+	if opts.CIDR == "" {
+		return fmt.Errorf("sweep requires --cidr")
+	}
+	_, target, err := net.ParseCIDR(opts.CIDR)
+	if err != nil {
+		return fmt.Errorf("invalid cidr %s: %w", opts.CIDR, err)
+	}
+	subnetCfg := config.SubnetConfig{CIDR: opts.CIDR}
+	for _, sub := range subs {
+		if sub.Network.String() == target.String() {
+			subnetCfg = configuredSubnet(cfg, sub.CIDR)
+			subnetCfg.CIDR = opts.CIDR
+			subnetCfg.ExcludeHosts = append([]string(nil), subnetCfg.ExcludeHosts...)
+		}
+	}
+	subnetCfg.ExcludeHosts = append(subnetCfg.ExcludeHosts, opts.Excludes...)
+	swept, err := subnets.FromConfigs([]config.SubnetConfig{subnetCfg})
+	if err != nil {
+		return err
+	}
+	chk, err := checker.New(cfg, swept, newHTTPClient(cfg), logger)
+	if err != nil {
+		return err
+	}
+	start := time.Now()
+	results, err := chk.Sweep(ctx, swept[0], checker.SweepOptions{
+		Rate:        opts.Rate,
+		Concurrency: opts.Concurrency,
+		Targets:     opts.Targets,
+	})
+	report := checker.BuildSweepReport(swept[0], results, opts.BlockPrefix)
+	report.Start = start
+	report.End = time.Now()
+	printSweepReport(report, swept[0].Pool.Size())
+	return ensureRunErrorHandled(err)
+}
+
+func configuredSubnet(cfg config.Config, cidr string) config.SubnetConfig {
+	for _, sub := range cfg.Subnets {
+		if sub.CIDR == cidr {
+			return sub
+		}
+	}
+	return config.SubnetConfig{CIDR: cidr}
+}
+
+func printSweepReport(report checker.SweepReport, available int) {
+	duration := report.End.Sub(report.Start).Truncate(time.Millisecond)
+	fmt.Printf("SWEEP %s %s hosts=%d/%d probes=%d failed_hosts=%d duration=%s\n", report.CIDR, report.Start.Format(time.RFC3339), report.Hosts, available, report.Probes, report.FailedHosts, duration.String())
+	for _, block := range report.FailedBlocks {
+		fmt.Printf("FAIL block=%s\n", block)
+	}
+	for _, res := range report.FailedIPs {
+		detail := res.Error
+		if detail == "" {
+			detail = "error"
+		}
+		fmt.Printf("FAIL ip=%s url=%s %s\n", res.SourceIP, res.URL, detail)
+	}
+}
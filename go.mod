@@ -2,4 +2,7 @@ module github.com/thealonlevi/subnet-sentinel
 
 go 1.23.3
 
-require gopkg.in/yaml.v3 v3.0.1
+require (
+	github.com/pelletier/go-toml/v2 v2.4.3
+	gopkg.in/yaml.v3 v3.0.1
+)
@@ -3,12 +3,17 @@ package checker
 import (
 	"context"
 	"fmt"
+	"hash/fnv"
+	mathrand "math/rand"
 	"net"
+	"reflect"
 	"time"
 
 	"github.com/thealonlevi/subnet-sentinel/internal/config"
+	"github.com/thealonlevi/subnet-sentinel/internal/coverage"
 	"github.com/thealonlevi/subnet-sentinel/internal/httpclient"
 	"github.com/thealonlevi/subnet-sentinel/internal/logging"
+	"github.com/thealonlevi/subnet-sentinel/internal/quarantine"
 	"github.com/thealonlevi/subnet-sentinel/internal/subnets"
 )
 
@@ -17,67 +22,313 @@ type HTTPClient interface {
 }
 
 type Checker struct {
-	Config  config.Config
-	Subnets []subnets.Subnet
-	Client  HTTPClient
-	Logger  logging.Logger
+	Config     config.Config
+	Subnets    []subnets.Subnet
+	Client     HTTPClient
+	Logger     logging.Logger
+	Coverage   *coverage.Tracker
+	Quarantine *quarantine.Store
+
+	samplers []subnets.Sampler
 }
 
 type Result struct {
-	Subnet     string
-	SourceIP   string
-	URL        string
-	Success    bool
-	StatusCode int
-	Duration   time.Duration
-	Error      string
+	Subnet      string
+	SourceIP    string
+	URL         string
+	Success     bool
+	StatusCode  int
+	Duration    time.Duration
+	Error       string
+	Drilldown   bool
+	Quarantined bool
+	Tags        map[string]string
+}
+
+type Report struct {
+	Seed    int64
+	Start   time.Time
+	End     time.Time
+	Results []Result
+	Blocks  []BlockVerdict
 }
 
 func New(cfg config.Config, subs []subnets.Subnet, client HTTPClient, logger logging.Logger) (*Checker, error) {
 	if client == nil {
 		return nil, fmt.Errorf("http client is required")
 	}
+	tracker, err := coverage.Load(cfg.Coverage.File)
+	if err != nil {
+		return nil, err
+	}
+	tracker.Retention = time.Duration(cfg.Coverage.RetentionHours) * time.Hour
+	store, err := quarantine.Load(cfg.Quarantine.File, cfg.Quarantine.FailureThreshold, cfg.Quarantine.ReleaseAfter)
+	if err != nil {
+		return nil, err
+	}
+	samplers := make([]subnets.Sampler, 0, len(subs))
+	for _, subnet := range subs {
+		sampler, err := newSampler(subnet, tracker)
+		if err != nil {
+			return nil, err
+		}
+		samplers = append(samplers, sampler)
+	}
 	return &Checker{
-		Config:  cfg,
-		Subnets: subs,
-		Client:  client,
-		Logger:  logger,
+		Config:     cfg,
+		Subnets:    subs,
+		Client:     client,
+		Logger:     logger,
+		Coverage:   tracker,
+		Quarantine: store,
+		samplers:   samplers,
 	}, nil
 }
 
+func (c *Checker) Update(cfg config.Config, subs []subnets.Subnet) error {
+	tracker := c.Coverage
+	if cfg.Coverage.File != c.Config.Coverage.File {
+		loaded, err := coverage.Load(cfg.Coverage.File)
+		if err != nil {
+			return err
+		}
+		tracker = loaded
+	}
+	store := c.Quarantine
+	if cfg.Quarantine.File != c.Config.Quarantine.File {
+		loaded, err := quarantine.Load(cfg.Quarantine.File, cfg.Quarantine.FailureThreshold, cfg.Quarantine.ReleaseAfter)
+		if err != nil {
+			return err
+		}
+		store = loaded
+	}
+	previous := make(map[string]int, len(c.Subnets))
+	for i, subnet := range c.Subnets {
+		previous[subnet.CIDR] = i
+	}
+	samplers := make([]subnets.Sampler, 0, len(subs))
+	for _, subnet := range subs {
+		if i, ok := previous[subnet.CIDR]; ok && tracker == c.Coverage && reflect.DeepEqual(c.Subnets[i].Sampling, subnet.Sampling) {
+			samplers = append(samplers, c.samplers[i])
+			continue
+		}
+		sampler, err := newSampler(subnet, tracker)
+		if err != nil {
+			return err
+		}
+		samplers = append(samplers, sampler)
+	}
+	if tracker != c.Coverage || store != c.Quarantine {
+		c.saveState()
+	}
+	tracker.Retention = time.Duration(cfg.Coverage.RetentionHours) * time.Hour
+	store.FailureThreshold = cfg.Quarantine.FailureThreshold
+	store.ReleaseAfter = cfg.Quarantine.ReleaseAfter
+	c.Config = cfg
+	c.Subnets = subs
+	c.Coverage = tracker
+	c.Quarantine = store
+	c.samplers = samplers
+	return nil
+}
+
+func newSampler(subnet subnets.Subnet, tracker *coverage.Tracker) (subnets.Sampler, error) {
+	if subnet.Sampling.Strategy == config.SamplingLeastRecent {
+		return coverage.Sampler{Tracker: tracker, Subnet: subnet.CIDR}, nil
+	}
+	return subnets.NewSampler(subnet)
+}
+
 func (c *Checker) Run(ctx context.Context) ([]Result, error) {
-	results := make([]Result, 0)
-	for _, subnet := range c.Subnets {
-		select {
-		case <-ctx.Done():
-			return results, ctx.Err()
-		default:
+	report, err := c.Execute(ctx)
+	return report.Results, err
+}
+
+func (c *Checker) Execute(ctx context.Context) (Report, error) {
+	if c.Config.Seed != nil {
+		return c.ExecuteSeed(ctx, *c.Config.Seed)
+	}
+	seed, err := subnets.RandomSeed()
+	if err != nil {
+		return Report{}, err
+	}
+	return c.ExecuteSeed(ctx, seed)
+}
+
+func (c *Checker) ExecuteSeed(ctx context.Context, seed int64) (Report, error) {
+	indices := make([]int, 0, len(c.Subnets))
+	for i := range c.Subnets {
+		indices = append(indices, i)
+	}
+	return c.ExecuteSubnets(ctx, seed, indices)
+}
+
+func (c *Checker) ExecuteSubnets(ctx context.Context, seed int64, indices []int) (Report, error) {
+	report := Report{Seed: seed, Start: time.Now(), Results: make([]Result, 0)}
+	defer c.saveState()
+	for _, i := range indices {
+		subnet := c.Subnets[i]
+		r := subnetRand(seed, subnet.CIDR)
+		results, retests, err := c.checkSubnet(ctx, r, i, subnet)
+		report.Results = append(report.Results, results...)
+		report.Results = append(report.Results, retests...)
+		if err == nil && c.Config.Localize.Enabled {
+			var extra []Result
+			var blocks []BlockVerdict
+			extra, blocks, err = c.localize(ctx, r, subnet, results)
+			report.Results = append(report.Results, extra...)
+			report.Blocks = append(report.Blocks, blocks...)
 		}
-		hosts, err := subnets.RandomHosts(subnet.Network, subnet.ExcludeHosts, c.Config.IPsPerSubnet)
 		if err != nil {
-			return results, fmt.Errorf("select hosts for %s: %w", subnet.CIDR, err)
+			report.End = time.Now()
+			return report, err
+		}
+	}
+	report.End = time.Now()
+	return report, nil
+}
+
+func (c *Checker) checkSubnet(ctx context.Context, r *mathrand.Rand, index int, subnet subnets.Subnet) ([]Result, []Result, error) {
+	select {
+	case <-ctx.Done():
+		return nil, nil, ctx.Err()
+	default:
+	}
+	pool := subnet.Pool
+	var quarantined []quarantine.Entry
+	if c.Config.Quarantine.Enabled {
+		quarantined = c.Quarantine.Quarantined(subnet.CIDR)
+		ips := make([]net.IP, 0, len(quarantined))
+		for _, entry := range quarantined {
+			ips = append(ips, net.ParseIP(entry.IP))
 		}
-		for _, host := range hosts {
-			for _, target := range c.Config.Targets {
-				select {
-				case <-ctx.Done():
-					return results, ctx.Err()
-				default:
-				}
-				res, err := c.performRequest(ctx, subnet.CIDR, host, target)
-				results = append(results, res)
-				if err != nil {
-					c.Logger.Error("request failed subnet=%s ip=%s url=%s error=%s", subnet.CIDR, host.String(), target, err.Error())
-				} else {
-					c.Logger.Debug("request succeeded subnet=%s ip=%s url=%s status=%d", subnet.CIDR, host.String(), target, res.StatusCode)
-				}
+		pool = pool.Without(ips)
+	}
+	var results []Result
+	count := c.SampleSizeFor(subnet)
+	if pool.Size() < subnet.Pool.Size() {
+		count = min(count, pool.Size())
+	}
+	if count == 0 && len(quarantined) > 0 {
+		c.Logger.Warn("every host is quarantined, only re-testing quarantined hosts", subnetAttrs(subnet, "quarantined", len(quarantined))...)
+	} else {
+		hosts, err := c.samplers[index].Select(r, pool, count)
+		if err != nil {
+			return nil, nil, fmt.Errorf("select hosts for %s: %w", subnet.CIDR, err)
+		}
+		results, err = c.probeHosts(ctx, subnet, hosts)
+		if err != nil {
+			return results, nil, err
+		}
+	}
+	if !c.Config.Quarantine.Enabled {
+		return results, nil, nil
+	}
+	retests, err := c.retestQuarantined(ctx, subnet, quarantined)
+	c.observeQuarantine(subnet, results, retests)
+	return results, retests, err
+}
+
+func (c *Checker) probeHosts(ctx context.Context, subnet subnets.Subnet, hosts []net.IP) ([]Result, error) {
+	targets := c.TargetsFor(subnet)
+	results := make([]Result, 0, len(hosts)*len(targets))
+	for _, host := range hosts {
+		for _, target := range targets {
+			select {
+			case <-ctx.Done():
+				return results, ctx.Err()
+			default:
+			}
+			res, err := c.performRequest(ctx, subnet, host, target)
+			results = append(results, res)
+			if err != nil {
+				c.Logger.Error("request failed", requestAttrs(subnet, host, target, res, err)...)
+			} else {
+				c.Logger.Debug("request succeeded", requestAttrs(subnet, host, target, res, nil)...)
 			}
 		}
 	}
 	return results, nil
 }
 
-func (c *Checker) performRequest(ctx context.Context, subnet string, ip net.IP, target string) (Result, error) {
+func (c *Checker) CoverageReport(window time.Duration) []coverage.SubnetCoverage {
+	since := time.Now().Add(-window)
+	report := make([]coverage.SubnetCoverage, 0, len(c.Subnets))
+	for _, subnet := range c.Subnets {
+		report = append(report, c.Coverage.Coverage(subnet.CIDR, subnet.Pool, since))
+	}
+	return report
+}
+
+func (c *Checker) saveState() {
+	if err := c.Coverage.Save(); err != nil {
+		c.Logger.Error("save coverage failed", "error", err.Error())
+	}
+	if err := c.Quarantine.Save(); err != nil {
+		c.Logger.Error("save quarantine failed", "error", err.Error())
+	}
+}
+
+func (c *Checker) TargetsFor(subnet subnets.Subnet) []string {
+	if len(subnet.Targets) > 0 {
+		return subnet.Targets
+	}
+	return c.Config.Targets
+}
+
+func (c *Checker) SampleSizeFor(subnet subnets.Subnet) int {
+	if subnet.IPsPerSubnet > 0 {
+		return subnet.IPsPerSubnet
+	}
+	return c.Config.IPsPerSubnet
+}
+
+func (c *Checker) IntervalFor(subnet subnets.Subnet) time.Duration {
+	if subnet.Interval > 0 {
+		return subnet.Interval
+	}
+	return time.Duration(c.Config.IntervalSeconds) * time.Second
+}
+
+func (c *Checker) TimeoutFor(subnet subnets.Subnet) time.Duration {
+	if subnet.Timeout > 0 {
+		return subnet.Timeout
+	}
+	return time.Duration(c.Config.TimeoutSeconds) * time.Second
+}
+
+func requestAttrs(subnet subnets.Subnet, host net.IP, target string, res Result, err error) []any {
+	attrs := []any{"ip", host.String(), "url", target}
+	if res.StatusCode != 0 {
+		attrs = append(attrs, "status", res.StatusCode)
+	}
+	attrs = append(attrs, "duration_ms", float64(res.Duration.Microseconds())/1000)
+	if err != nil {
+		attrs = append(attrs, "error", err.Error())
+	}
+	return subnetAttrs(subnet, attrs...)
+}
+
+func subnetAttrs(subnet subnets.Subnet, args ...any) []any {
+	attrs := append([]any{"subnet", subnet.CIDR}, args...)
+	if len(subnet.Tags) > 0 {
+		attrs = append(attrs, "tags", subnets.FormatTags(subnet.Tags))
+	}
+	return attrs
+}
+
+func subnetRand(seed int64, cidr string) *mathrand.Rand {
+	h := fnv.New64a()
+	h.Write([]byte(cidr))
+	return subnets.NewSeededRand(seed ^ int64(h.Sum64()))
+}
+
+func (c *Checker) performRequest(ctx context.Context, subnet subnets.Subnet, ip net.IP, target string) (Result, error) {
+	if timeout := c.TimeoutFor(subnet); timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
 	start := time.Now()
 	res, err := c.Client.Do(ctx, ip, target)
 	duration := res.Duration
@@ -85,15 +336,17 @@ func (c *Checker) performRequest(ctx context.Context, subnet string, ip net.IP,
 		duration = time.Since(start)
 	}
 	result := Result{
-		Subnet:     subnet,
+		Subnet:     subnet.CIDR,
 		SourceIP:   ip.String(),
 		URL:        target,
 		Success:    err == nil,
 		StatusCode: res.StatusCode,
 		Duration:   duration,
+		Tags:       subnet.Tags,
 	}
 	if err != nil {
 		result.Error = err.Error()
 	}
+	c.Coverage.Record(subnet.CIDR, ip, start)
 	return result, err
 }
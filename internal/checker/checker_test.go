@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"net"
+	"strings"
 	"testing"
 	"time"
 
@@ -111,3 +112,425 @@ func TestCheckerRunCollectsResults(t *testing.T) {
 		t.Fatalf("expected same host ip for both calls")
 	}
 }
+
+func TestCheckerLocalizesFailingBlock(t *testing.T) {
+	cfg := config.Config{
+		Subnets: []config.SubnetConfig{
+			{CIDR: "10.9.0.0/22", Sampling: config.SamplingConfig{Strategy: config.SamplingStratified}},
+		},
+		Targets:      []string{"https://a.test"},
+		IPsPerSubnet: 8,
+		Localize:     config.LocalizeConfig{Enabled: true, BlockPrefix: 24, Samples: 4},
+	}
+	subs, err := subnets.FromConfigs(cfg.Subnets)
+	if err != nil {
+		t.Fatalf("subnet parse: %v", err)
+	}
+	client := funcHTTPClient(func(source net.IP, url string) (httpclient.Result, error) {
+		if source.To4()[2] == 2 {
+			return httpclient.Result{}, fmt.Errorf("connection refused")
+		}
+		return httpclient.Result{StatusCode: 200}, nil
+	})
+	logger, err := logging.New("error")
+	if err != nil {
+		t.Fatalf("logger init: %v", err)
+	}
+	chk, err := New(cfg, subs, client, logger)
+	if err != nil {
+		t.Fatalf("checker init: %v", err)
+	}
+	report, err := chk.Execute(context.Background())
+	if err != nil {
+		t.Fatalf("checker run: %v", err)
+	}
+	drilled := 0
+	for _, res := range report.Results {
+		if res.Drilldown {
+			drilled++
+			if !strings.HasPrefix(res.SourceIP, "10.9.2.") {
+				t.Fatalf("unexpected drilldown host %s", res.SourceIP)
+			}
+		}
+	}
+	if drilled != 4 {
+		t.Fatalf("expected 4 drilldown probes, got %d", drilled)
+	}
+	if len(report.Blocks) != 4 {
+		t.Fatalf("expected 4 block verdicts, got %d", len(report.Blocks))
+	}
+	for _, block := range report.Blocks {
+		expected := VerdictOK
+		hosts := 2
+		if block.Block == "10.9.2.0/24" {
+			expected = VerdictBad
+			hosts = 6
+		}
+		if block.Verdict != expected || block.Hosts != hosts {
+			t.Fatalf("unexpected verdict for %s: %s %d/%d", block.Block, block.Verdict, block.Failed, block.Hosts)
+		}
+	}
+}
+
+func TestCheckerSeedReproducesSelection(t *testing.T) {
+	cfg := config.Config{
+		Subnets: []config.SubnetConfig{
+			{CIDR: "10.7.0.0/21"},
+			{CIDR: "10.8.0.0/21", Sampling: config.SamplingConfig{Strategy: config.SamplingStratified}},
+		},
+		Targets:      []string{"https://a.test"},
+		IPsPerSubnet: 5,
+	}
+	subs, err := subnets.FromConfigs(cfg.Subnets)
+	if err != nil {
+		t.Fatalf("subnet parse: %v", err)
+	}
+	client := funcHTTPClient(func(source net.IP, url string) (httpclient.Result, error) {
+		return httpclient.Result{StatusCode: 200}, nil
+	})
+	logger, err := logging.New("error")
+	if err != nil {
+		t.Fatalf("logger init: %v", err)
+	}
+	selection := func(seed int64) []string {
+		chk, err := New(cfg, subs, client, logger)
+		if err != nil {
+			t.Fatalf("checker init: %v", err)
+		}
+		report, err := chk.ExecuteSeed(context.Background(), seed)
+		if err != nil {
+			t.Fatalf("checker run: %v", err)
+		}
+		if report.Seed != seed {
+			t.Fatalf("expected seed %d recorded, got %d", seed, report.Seed)
+		}
+		ips := make([]string, 0, len(report.Results))
+		for _, res := range report.Results {
+			ips = append(ips, res.SourceIP)
+		}
+		return ips
+	}
+	first := strings.Join(selection(42), ",")
+	if again := strings.Join(selection(42), ","); again != first {
+		t.Fatalf("expected identical selection for same seed, got %s and %s", first, again)
+	}
+	if other := strings.Join(selection(43), ","); other == first {
+		t.Fatalf("expected different selection for different seed")
+	}
+}
+
+func TestCheckerQuarantinesConsistentlyFailingHost(t *testing.T) {
+	cfg := config.Config{
+		Subnets:      []config.SubnetConfig{{CIDR: "10.6.0.0/29"}},
+		Targets:      []string{"https://a.test"},
+		IPsPerSubnet: 6,
+		Quarantine:   config.QuarantineConfig{Enabled: true, FailureThreshold: 2, ReleaseAfter: 1},
+	}
+	subs, err := subnets.FromConfigs(cfg.Subnets)
+	if err != nil {
+		t.Fatalf("subnet parse: %v", err)
+	}
+	blocked := true
+	client := funcHTTPClient(func(source net.IP, url string) (httpclient.Result, error) {
+		if blocked && source.String() == "10.6.0.3" {
+			return httpclient.Result{StatusCode: 403}, fmt.Errorf("unexpected status 403")
+		}
+		return httpclient.Result{StatusCode: 200}, nil
+	})
+	logger, err := logging.New("error")
+	if err != nil {
+		t.Fatalf("logger init: %v", err)
+	}
+	chk, err := New(cfg, subs, client, logger)
+	if err != nil {
+		t.Fatalf("checker init: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := chk.Run(context.Background()); err != nil {
+			t.Fatalf("checker run: %v", err)
+		}
+	}
+	entries := chk.Quarantine.Quarantined("10.6.0.0/29")
+	if len(entries) != 1 || entries[0].IP != "10.6.0.3" {
+		t.Fatalf("expected 10.6.0.3 quarantined, got %+v", entries)
+	}
+	blocked = false
+	results, err := chk.Run(context.Background())
+	if err != nil {
+		t.Fatalf("checker run: %v", err)
+	}
+	for _, res := range results {
+		if res.SourceIP == "10.6.0.3" && !res.Quarantined {
+			t.Fatalf("quarantined host sampled as regular host")
+		}
+	}
+	if len(results) != 6 {
+		t.Fatalf("expected 5 sampled and 1 retest result, got %d", len(results))
+	}
+	if len(chk.Quarantine.List()) != 0 {
+		t.Fatalf("expected host released after successful retest")
+	}
+}
+
+func TestCheckerSamplesRemainingHostsWhenQuarantineShrinksPool(t *testing.T) {
+	cfg := config.Config{
+		Subnets:      []config.SubnetConfig{{CIDR: "10.7.0.0/29"}},
+		Targets:      []string{"https://a.test"},
+		IPsPerSubnet: 4,
+		Quarantine:   config.QuarantineConfig{Enabled: true, FailureThreshold: 1, ReleaseAfter: 3},
+	}
+	subs, err := subnets.FromConfigs(cfg.Subnets)
+	if err != nil {
+		t.Fatalf("subnet parse: %v", err)
+	}
+	client := funcHTTPClient(func(source net.IP, url string) (httpclient.Result, error) {
+		return httpclient.Result{StatusCode: 200}, nil
+	})
+	logger, err := logging.New("error")
+	if err != nil {
+		t.Fatalf("logger init: %v", err)
+	}
+	chk, err := New(cfg, subs, client, logger)
+	if err != nil {
+		t.Fatalf("checker init: %v", err)
+	}
+	for _, host := range []string{"10.7.0.1", "10.7.0.2", "10.7.0.3", "10.7.0.4"} {
+		chk.Quarantine.Observe("10.7.0.0/29", net.ParseIP(host), false, "unexpected status 403", time.Now())
+	}
+	results, err := chk.Run(context.Background())
+	if err != nil {
+		t.Fatalf("checker run with 4 of 6 hosts quarantined: %v", err)
+	}
+	sampled, retested := 0, 0
+	for _, res := range results {
+		if res.Quarantined {
+			retested++
+		} else {
+			sampled++
+		}
+	}
+	if sampled != 2 || retested != 4 {
+		t.Fatalf("expected the 2 remaining hosts sampled and 4 retests, got %d and %d", sampled, retested)
+	}
+	for _, host := range []string{"10.7.0.5", "10.7.0.6"} {
+		chk.Quarantine.Observe("10.7.0.0/29", net.ParseIP(host), false, "unexpected status 403", time.Now())
+	}
+	results, err = chk.Run(context.Background())
+	if err != nil {
+		t.Fatalf("checker run with every host quarantined: %v", err)
+	}
+	if len(results) != 6 {
+		t.Fatalf("expected 6 retests, got %d", len(results))
+	}
+	for _, res := range results {
+		if !res.Quarantined {
+			t.Fatalf("expected only retests when every host is quarantined, got %+v", res)
+		}
+	}
+	cfg.IPsPerSubnet = 7
+	cfg.Quarantine.Enabled = false
+	if err := chk.Update(cfg, subs); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if _, err := chk.Run(context.Background()); err == nil || !strings.Contains(err.Error(), "select hosts for 10.7.0.0/29") {
+		t.Fatalf("expected ipsPerSubnet above the subnet size to fail without quarantine, got %v", err)
+	}
+}
+
+func TestCheckerAppliesSubnetOverrides(t *testing.T) {
+	cfg := config.Config{
+		Subnets: []config.SubnetConfig{
+			{CIDR: "10.10.0.0/24"},
+			{CIDR: "10.11.0.0/24", Targets: []string{"https://customer.test"}, IPsPerSubnet: 3, TimeoutSeconds: 2},
+		},
+		Targets:        []string{"https://a.test", "https://b.test"},
+		IPsPerSubnet:   1,
+		TimeoutSeconds: 10,
+	}
+	subs, err := subnets.FromConfigs(cfg.Subnets)
+	if err != nil {
+		t.Fatalf("subnet parse: %v", err)
+	}
+	logger, err := logging.New("error")
+	if err != nil {
+		t.Fatalf("logger init: %v", err)
+	}
+	chk, err := New(cfg, subs, funcHTTPClient(func(source net.IP, url string) (httpclient.Result, error) {
+		return httpclient.Result{StatusCode: 200}, nil
+	}), logger)
+	if err != nil {
+		t.Fatalf("checker init: %v", err)
+	}
+	results, err := chk.Run(context.Background())
+	if err != nil {
+		t.Fatalf("checker run: %v", err)
+	}
+	counts := make(map[string]int)
+	for _, res := range results {
+		counts[res.Subnet+" "+res.URL]++
+	}
+	expected := map[string]int{
+		"10.10.0.0/24 https://a.test":        1,
+		"10.10.0.0/24 https://b.test":        1,
+		"10.11.0.0/24 https://customer.test": 3,
+	}
+	if len(counts) != len(expected) {
+		t.Fatalf("unexpected probes %v", counts)
+	}
+	for key, count := range expected {
+		if counts[key] != count {
+			t.Fatalf("expected %d probes for %s, got %d", count, key, counts[key])
+		}
+	}
+	if timeout := chk.TimeoutFor(subs[1]); timeout != 2*time.Second {
+		t.Fatalf("expected subnet timeout 2s, got %s", timeout)
+	}
+	if timeout := chk.TimeoutFor(subs[0]); timeout != 10*time.Second {
+		t.Fatalf("expected global timeout 10s, got %s", timeout)
+	}
+}
+
+func TestCheckerUpdateKeepsSamplerState(t *testing.T) {
+	sweep := config.SamplingConfig{Strategy: config.SamplingSweep}
+	cfg := config.Config{
+		Subnets:      []config.SubnetConfig{{CIDR: "10.12.0.0/29", Sampling: sweep}},
+		Targets:      []string{"https://a.test"},
+		IPsPerSubnet: 2,
+	}
+	subs, err := subnets.FromConfigs(cfg.Subnets)
+	if err != nil {
+		t.Fatalf("subnet parse: %v", err)
+	}
+	logger, err := logging.New("error")
+	if err != nil {
+		t.Fatalf("logger init: %v", err)
+	}
+	chk, err := New(cfg, subs, funcHTTPClient(func(source net.IP, url string) (httpclient.Result, error) {
+		return httpclient.Result{StatusCode: 200}, nil
+	}), logger)
+	if err != nil {
+		t.Fatalf("checker init: %v", err)
+	}
+	if _, err := chk.Run(context.Background()); err != nil {
+		t.Fatalf("checker run: %v", err)
+	}
+	updated := cfg
+	updated.Subnets = []config.SubnetConfig{{CIDR: "10.12.0.0/29", Sampling: sweep}, {CIDR: "10.13.0.0/29"}}
+	updatedSubs, err := subnets.FromConfigs(updated.Subnets)
+	if err != nil {
+		t.Fatalf("subnet parse: %v", err)
+	}
+	if err := chk.Update(updated, updatedSubs); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	results, err := chk.Run(context.Background())
+	if err != nil {
+		t.Fatalf("checker run: %v", err)
+	}
+	if len(results) != 4 {
+		t.Fatalf("expected 4 results after adding a subnet, got %d", len(results))
+	}
+	if results[0].SourceIP != "10.12.0.3" || results[1].SourceIP != "10.12.0.4" {
+		t.Fatalf("expected sweep to continue after reload, got %s and %s", results[0].SourceIP, results[1].SourceIP)
+	}
+	if results[2].Subnet != "10.13.0.0/29" {
+		t.Fatalf("expected new subnet to be checked, got %s", results[2].Subnet)
+	}
+}
+
+func TestSummarizeGroupsSubnetsAndSkipsQuarantined(t *testing.T) {
+	ms := func(n int) time.Duration { return time.Duration(n) * time.Millisecond }
+	results := []Result{
+		{Subnet: "10.0.0.0/24", SourceIP: "10.0.0.1", Success: true, Duration: ms(40)},
+		{Subnet: "10.1.0.0/24", SourceIP: "10.1.0.1", Success: false, Error: "timeout", Duration: ms(900)},
+		{Subnet: "10.0.0.0/24", SourceIP: "10.0.0.2", Success: true, Duration: ms(10)},
+		{Subnet: "10.0.0.0/24", SourceIP: "10.0.0.3", Success: false, StatusCode: 502},
+		{Subnet: "10.0.0.0/24", SourceIP: "10.0.0.4", Success: true, Duration: ms(20)},
+		{Subnet: "10.0.0.0/24", SourceIP: "10.0.0.5", Success: false, Quarantined: true},
+		{Subnet: "10.0.0.0/24", SourceIP: "10.0.0.6", Success: false, Drilldown: true},
+		{Subnet: "10.0.0.0/24", SourceIP: "10.0.0.7", Success: true, Duration: ms(5), Drilldown: true},
+	}
+	summaries := Summarize(results)
+	if len(summaries) != 2 || summaries[0].Subnet != "10.0.0.0/24" || summaries[1].Subnet != "10.1.0.0/24" {
+		t.Fatalf("unexpected grouping %+v", summaries)
+	}
+	first := summaries[0]
+	if first.Total != 4 || first.Succeeded != 3 || first.Failed != 1 || first.Quarantined != 1 || first.Drilldown != 2 {
+		t.Fatalf("unexpected counts %+v", first)
+	}
+	if first.SuccessRatio() != 0.75 || first.P50 != ms(20) || first.P95 != ms(40) {
+		t.Fatalf("unexpected ratio or latency %+v", first)
+	}
+	if len(first.Failures) != 1 || FailureReason(first.Failures[0]) != "status 502" {
+		t.Fatalf("unexpected failures %+v", first.Failures)
+	}
+	second := summaries[1]
+	if second.SuccessRatio() != 0 || second.P50 != 0 || FailureReason(second.Failures[0]) != "timeout" {
+		t.Fatalf("unexpected failing subnet summary %+v", second)
+	}
+}
+
+func TestEvaluateAppliesThresholds(t *testing.T) {
+	percent := func(v float64) *float64 { return &v }
+	results := []Result{
+		{Subnet: "10.0.0.0/24", Success: true},
+		{Subnet: "10.0.0.0/24", Success: true},
+		{Subnet: "10.0.0.0/24", Success: true},
+		{Subnet: "10.0.0.0/24", Success: false},
+		{Subnet: "10.1.0.0/24", Success: true},
+		{Subnet: "10.1.0.0/24", Success: false, Quarantined: true},
+	}
+	cases := []struct {
+		name       string
+		results    []Result
+		thresholds config.ThresholdsConfig
+		want       Status
+	}{
+		{"defaults warn on any failure", results, config.ThresholdsConfig{}, StatusWarning},
+		{"below warning", results, config.ThresholdsConfig{WarningPercent: percent(80), CriticalPercent: percent(50)}, StatusWarning},
+		{"above warning", results, config.ThresholdsConfig{WarningPercent: percent(75), CriticalPercent: percent(50)}, StatusOK},
+		{"below critical", results, config.ThresholdsConfig{WarningPercent: percent(90), CriticalPercent: percent(80)}, StatusCritical},
+		{"all passing", results[4:], config.ThresholdsConfig{}, StatusOK},
+		{"total failure", []Result{{Subnet: "10.0.0.0/24"}, {Subnet: "10.1.0.0/24"}}, config.ThresholdsConfig{WarningPercent: percent(0)}, StatusCritical},
+		{"nothing evaluated", results[5:], config.ThresholdsConfig{}, StatusUnknown},
+	}
+	for _, tc := range cases {
+		eval := Evaluate(tc.results, tc.thresholds)
+		if eval.Status != tc.want {
+			t.Fatalf("%s: status %s, want %s (%v)", tc.name, eval.Status, tc.want, eval.Reasons)
+		}
+		if eval.Status != StatusOK && len(eval.Reasons) == 0 {
+			t.Fatalf("%s: expected reasons", tc.name)
+		}
+	}
+}
+
+func TestErrorClassGroupsFailures(t *testing.T) {
+	cases := map[string]Result{
+		"":                   {Success: true, StatusCode: 200},
+		"http_status":        {StatusCode: 502, Error: "unexpected status 502"},
+		"timeout":            {Error: `Get "https://example.com": context deadline exceeded (Client.Timeout exceeded while awaiting headers)`},
+		"connection_refused": {Error: "dial tcp 10.0.0.7:0->1.2.3.4:443: connect: connection refused"},
+		"dns":                {Error: "dial tcp: lookup example.invalid: no such host"},
+		"tls":                {Error: "tls: failed to verify certificate: x509: certificate signed by unknown authority"},
+		"source_address":     {Error: "dial tcp 10.0.0.7:0->1.2.3.4:443: bind: cannot assign requested address"},
+		"other":              {Error: "something unexpected"},
+	}
+	for want, res := range cases {
+		if got := ErrorClass(res); got != want {
+			t.Fatalf("ErrorClass(%q) = %q, want %q", res.Error, got, want)
+		}
+	}
+	classes := map[string]string{
+		`Get "https://example.com": EOF`:                       "connection_reset",
+		"read tcp 10.0.0.7:41234->1.2.3.4:443: unexpected EOF": "connection_reset",
+		"EOF":                             "connection_reset",
+		"proxy rejected geofenced source": "other",
+	}
+	for message, want := range classes {
+		res := Result{Error: message}
+		if got := ErrorClass(res); got != want {
+			t.Fatalf("ErrorClass(%q) = %q, want %q", res.Error, got, want)
+		}
+	}
+}
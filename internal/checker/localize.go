@@ -0,0 +1,117 @@
+package checker
+
+import (
+	"context"
+	mathrand "math/rand"
+	"net"
+
+	"github.com/thealonlevi/subnet-sentinel/internal/subnets"
+)
+
+const (
+	VerdictOK       = "ok"
+	VerdictDegraded = "degraded"
+	VerdictBad      = "bad"
+)
+
+type BlockVerdict struct {
+	Subnet  string
+	Block   string
+	Hosts   int
+	Failed  int
+	Verdict string
+	Tags    map[string]string
+}
+
+func (c *Checker) localize(ctx context.Context, r *mathrand.Rand, subnet subnets.Subnet, results []Result) ([]Result, []BlockVerdict, error) {
+	failedHosts := hostOutcomes(results)
+	anyFailed := false
+	for _, failed := range failedHosts {
+		if failed {
+			anyFailed = true
+			break
+		}
+	}
+	if !anyFailed {
+		return nil, nil, nil
+	}
+	maskSize, _ := subnet.Network.Mask.Size()
+	prefix := c.Config.Localize.BlockPrefix
+	if prefix <= maskSize {
+		prefix = maskSize + 1
+	}
+	extra := make([]Result, 0)
+	verdicts := make([]BlockVerdict, 0)
+	for _, block := range subnet.Pool.Blocks(prefix) {
+		probed := make([]net.IP, 0)
+		blockFailed := false
+		for host, failed := range failedHosts {
+			ip := net.ParseIP(host)
+			if block.Contains(ip) {
+				probed = append(probed, ip)
+				blockFailed = blockFailed || failed
+			}
+		}
+		if len(probed) == 0 {
+			continue
+		}
+		if blockFailed && c.Config.Localize.Samples > 0 {
+			candidates := block.Without(probed)
+			count := c.Config.Localize.Samples
+			if count > candidates.Size() {
+				count = candidates.Size()
+			}
+			if count > 0 {
+				hosts, err := candidates.Sample(r, count)
+				if err != nil {
+					return extra, verdicts, err
+				}
+				drilled, err := c.probeHosts(ctx, subnet, hosts)
+				for i := range drilled {
+					drilled[i].Drilldown = true
+				}
+				extra = append(extra, drilled...)
+				if err != nil {
+					return extra, verdicts, err
+				}
+			}
+		}
+		verdicts = append(verdicts, blockVerdict(subnet, block, results, extra))
+	}
+	for _, verdict := range verdicts {
+		c.Logger.Info("localized", subnetAttrs(subnet, "block", verdict.Block, "verdict", verdict.Verdict, "failed", verdict.Failed, "hosts", verdict.Hosts)...)
+	}
+	return extra, verdicts, nil
+}
+
+func blockVerdict(subnet subnets.Subnet, block *subnets.HostPool, sets ...[]Result) BlockVerdict {
+	verdict := BlockVerdict{Subnet: subnet.CIDR, Block: block.Name(), Tags: subnet.Tags}
+	for host, failed := range hostOutcomes(sets...) {
+		if !block.Contains(net.ParseIP(host)) {
+			continue
+		}
+		verdict.Hosts++
+		if failed {
+			verdict.Failed++
+		}
+	}
+	switch {
+	case verdict.Failed == 0:
+		verdict.Verdict = VerdictOK
+	case verdict.Failed == verdict.Hosts:
+		verdict.Verdict = VerdictBad
+	default:
+		verdict.Verdict = VerdictDegraded
+	}
+	return verdict
+}
+
+func hostOutcomes(sets ...[]Result) map[string]bool {
+	outcomes := make(map[string]bool)
+	for _, results := range sets {
+		for _, res := range results {
+			outcomes[res.SourceIP] = outcomes[res.SourceIP] || !res.Success
+		}
+	}
+	return outcomes
+}
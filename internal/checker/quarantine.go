@@ -0,0 +1,95 @@
+package checker
+
+import (
+	"context"
+	"net"
+	"sort"
+	"time"
+
+	"github.com/thealonlevi/subnet-sentinel/internal/quarantine"
+	"github.com/thealonlevi/subnet-sentinel/internal/subnets"
+)
+
+func (c *Checker) retestQuarantined(ctx context.Context, subnet subnets.Subnet, entries []quarantine.Entry) ([]Result, error) {
+	if len(entries) == 0 {
+		return nil, nil
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].LastTested.Before(entries[j].LastTested)
+	})
+	limit := c.Config.Quarantine.RetestPerRun
+	if limit > 0 && limit < len(entries) {
+		entries = entries[:limit]
+	}
+	hosts := make([]net.IP, 0, len(entries))
+	for _, entry := range entries {
+		hosts = append(hosts, net.ParseIP(entry.IP).To4())
+	}
+	results, err := c.probeHosts(ctx, subnet, hosts)
+	for i := range results {
+		results[i].Quarantined = true
+	}
+	return results, err
+}
+
+func (c *Checker) observeQuarantine(subnet subnets.Subnet, results []Result, retests []Result) {
+	now := time.Now()
+	outcomes := hostOutcomes(results)
+	healthy := false
+	for _, failed := range outcomes {
+		if !failed {
+			healthy = true
+			break
+		}
+	}
+	reasons := failureReasons(results, retests)
+	for _, host := range sampledOrder(results) {
+		failed := outcomes[host]
+		if failed && !healthy {
+			continue
+		}
+		c.logQuarantineEvent(subnet, host, c.Quarantine.Observe(subnet.CIDR, net.ParseIP(host), !failed, reasons[host], now), reasons[host])
+	}
+	retestOutcomes := hostOutcomes(retests)
+	for _, host := range sampledOrder(retests) {
+		failed := retestOutcomes[host]
+		c.logQuarantineEvent(subnet, host, c.Quarantine.Observe(subnet.CIDR, net.ParseIP(host), !failed, reasons[host], now), reasons[host])
+	}
+}
+
+func (c *Checker) logQuarantineEvent(subnet subnets.Subnet, host string, event string, reason string) {
+	switch event {
+	case quarantine.EventQuarantined:
+		c.Logger.Warn("quarantined", subnetAttrs(subnet, "ip", host, "reason", reason)...)
+	case quarantine.EventReleased:
+		c.Logger.Info("released from quarantine", subnetAttrs(subnet, "ip", host)...)
+	}
+}
+
+func failureReasons(sets ...[]Result) map[string]string {
+	reasons := make(map[string]string)
+	for _, results := range sets {
+		for _, res := range results {
+			if res.Success {
+				continue
+			}
+			if _, ok := reasons[res.SourceIP]; !ok {
+				reasons[res.SourceIP] = res.URL + ": " + res.Error
+			}
+		}
+	}
+	return reasons
+}
+
+func sampledOrder(results []Result) []string {
+	seen := make(map[string]struct{})
+	order := make([]string, 0)
+	for _, res := range results {
+		if _, ok := seen[res.SourceIP]; ok {
+			continue
+		}
+		seen[res.SourceIP] = struct{}{}
+		order = append(order, res.SourceIP)
+	}
+	return order
+}
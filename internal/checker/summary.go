@@ -0,0 +1,187 @@
+package checker
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/thealonlevi/subnet-sentinel/internal/config"
+)
+
+type Status int
+
+const (
+	StatusOK Status = iota
+	StatusWarning
+	StatusCritical
+	StatusUnknown
+)
+
+func (s Status) String() string {
+	switch s {
+	case StatusOK:
+		return "OK"
+	case StatusWarning:
+		return "WARNING"
+	case StatusCritical:
+		return "CRITICAL"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+type Evaluation struct {
+	Status    Status
+	Reasons   []string
+	Summaries []SubnetSummary
+}
+
+type SubnetSummary struct {
+	Subnet      string
+	Tags        map[string]string
+	Total       int
+	Succeeded   int
+	Failed      int
+	Quarantined int
+	Drilldown   int
+	P50         time.Duration
+	P95         time.Duration
+	Failures    []Result
+}
+
+func (s SubnetSummary) SuccessRatio() float64 {
+	if s.Total == 0 {
+		return 1
+	}
+	return float64(s.Succeeded) / float64(s.Total)
+}
+
+func Summarize(results []Result) []SubnetSummary {
+	summaries := make([]SubnetSummary, 0)
+	index := make(map[string]int)
+	durations := make(map[string][]time.Duration)
+	for _, res := range results {
+		i, ok := index[res.Subnet]
+		if !ok {
+			i = len(summaries)
+			index[res.Subnet] = i
+			summaries = append(summaries, SubnetSummary{Subnet: res.Subnet, Tags: res.Tags})
+		}
+		summary := &summaries[i]
+		if res.Quarantined {
+			summary.Quarantined++
+			continue
+		}
+		if res.Drilldown {
+			summary.Drilldown++
+			continue
+		}
+		summary.Total++
+		if res.Success {
+			summary.Succeeded++
+			durations[res.Subnet] = append(durations[res.Subnet], res.Duration)
+			continue
+		}
+		summary.Failed++
+		summary.Failures = append(summary.Failures, res)
+	}
+	for i := range summaries {
+		values := durations[summaries[i].Subnet]
+		sort.Slice(values, func(a, b int) bool { return values[a] < values[b] })
+		summaries[i].P50 = percentile(values, 50)
+		summaries[i].P95 = percentile(values, 95)
+	}
+	return summaries
+}
+
+func Evaluate(results []Result, thresholds config.ThresholdsConfig) Evaluation {
+	eval := Evaluation{Status: StatusOK, Summaries: Summarize(results)}
+	warning, critical := 100.0, 0.0
+	if thresholds.WarningPercent != nil {
+		warning = *thresholds.WarningPercent
+	}
+	if thresholds.CriticalPercent != nil {
+		critical = *thresholds.CriticalPercent
+	}
+	total, succeeded := 0, 0
+	for _, summary := range eval.Summaries {
+		total += summary.Total
+		succeeded += summary.Succeeded
+		percent := summary.SuccessRatio() * 100
+		switch {
+		case percent < critical:
+			eval.raise(StatusCritical, fmt.Sprintf("%s success %.1f%% below %g%%", summary.Subnet, percent, critical))
+		case percent < warning:
+			eval.raise(StatusWarning, fmt.Sprintf("%s success %.1f%% below %g%%", summary.Subnet, percent, warning))
+		}
+	}
+	switch {
+	case total == 0:
+		eval.Status = StatusUnknown
+		eval.Reasons = []string{"no probes were evaluated"}
+	case succeeded == 0:
+		eval.raise(StatusCritical, fmt.Sprintf("all %d probes failed", total))
+	}
+	return eval
+}
+
+func (e *Evaluation) raise(status Status, reason string) {
+	if status > e.Status {
+		e.Status = status
+	}
+	e.Reasons = append(e.Reasons, reason)
+}
+
+func FailureReason(res Result) string {
+	if res.Error != "" {
+		return res.Error
+	}
+	if res.StatusCode != 0 {
+		return fmt.Sprintf("status %d", res.StatusCode)
+	}
+	return "error"
+}
+
+func ErrorClass(res Result) string {
+	if res.Success {
+		return ""
+	}
+	message := strings.ToLower(res.Error)
+	switch {
+	case res.StatusCode != 0:
+		return "http_status"
+	case strings.Contains(message, "timeout") || strings.Contains(message, "deadline exceeded"):
+		return "timeout"
+	case strings.Contains(message, "connection refused"):
+		return "connection_refused"
+	case strings.Contains(message, "connection reset") || strings.Contains(message, "broken pipe") || isEOF(res.Error):
+		return "connection_reset"
+	case strings.Contains(message, "no such host") || strings.Contains(message, "lookup "):
+		return "dns"
+	case strings.Contains(message, "tls:") || strings.Contains(message, "x509:"):
+		return "tls"
+	case strings.Contains(message, "network is unreachable") || strings.Contains(message, "no route to host") || strings.Contains(message, "host is down"):
+		return "unreachable"
+	case strings.Contains(message, "cannot assign requested address") || strings.Contains(message, "source ip"):
+		return "source_address"
+	default:
+		return "other"
+	}
+}
+
+func isEOF(message string) bool {
+	return message == io.EOF.Error() || strings.HasSuffix(message, ": "+io.EOF.Error()) || strings.Contains(message, io.ErrUnexpectedEOF.Error())
+}
+
+func percentile(sorted []time.Duration, p int) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
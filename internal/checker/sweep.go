@@ -0,0 +1,180 @@
+package checker
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/thealonlevi/subnet-sentinel/internal/subnets"
+)
+
+type SweepOptions struct {
+	Rate        float64
+	Concurrency int
+	Targets     []string
+}
+
+type SweepReport struct {
+	CIDR         string
+	Hosts        int
+	Probes       int
+	FailedHosts  int
+	Start        time.Time
+	End          time.Time
+	FailedBlocks []string
+	FailedIPs    []Result
+}
+
+func (c *Checker) Sweep(ctx context.Context, subnet subnets.Subnet, opts SweepOptions) ([]Result, error) {
+	targets := opts.Targets
+	if len(targets) == 0 {
+		targets = c.TargetsFor(subnet)
+	}
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("no targets configured")
+	}
+	concurrency := opts.Concurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	if math.IsNaN(opts.Rate) || math.IsInf(opts.Rate, 0) {
+		return nil, fmt.Errorf("sweep rate must be a finite number, got %v", opts.Rate)
+	}
+	var ticker *time.Ticker
+	if interval := float64(time.Second) / opts.Rate; opts.Rate > 0 && interval >= 1 {
+		ticker = time.NewTicker(time.Duration(interval))
+		defer ticker.Stop()
+	}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, concurrency)
+	var results []Result
+	var runErr error
+	defer c.saveState()
+loop:
+	for i := 0; i < subnet.Pool.Size(); i++ {
+		host := subnet.Pool.At(i)
+		for _, target := range targets {
+			if ticker != nil {
+				select {
+				case <-ctx.Done():
+					runErr = ctx.Err()
+					break loop
+				case <-ticker.C:
+				}
+			}
+			select {
+			case <-ctx.Done():
+				runErr = ctx.Err()
+				break loop
+			case sem <- struct{}{}:
+			}
+			wg.Add(1)
+			go func(host net.IP, target string) {
+				defer wg.Done()
+				defer func() { <-sem }()
+				res, err := c.performRequest(ctx, subnet, host, target)
+				if err != nil {
+					c.Logger.Error("sweep request failed", requestAttrs(subnet, host, target, res, err)...)
+				} else {
+					c.Logger.Debug("sweep request succeeded", requestAttrs(subnet, host, target, res, nil)...)
+				}
+				mu.Lock()
+				results = append(results, res)
+				mu.Unlock()
+			}(host, target)
+		}
+	}
+	wg.Wait()
+	sort.SliceStable(results, func(i, j int) bool {
+		return ipLess(results[i].SourceIP, results[j].SourceIP)
+	})
+	return results, runErr
+}
+
+func BuildSweepReport(subnet subnets.Subnet, results []Result, minBlockPrefix int) SweepReport {
+	report := SweepReport{
+		CIDR:   subnet.CIDR,
+		Probes: len(results),
+	}
+	failed := make(map[uint32]bool)
+	firstFailure := make(map[uint32]Result)
+	for _, res := range results {
+		ip := net.ParseIP(res.SourceIP).To4()
+		if ip == nil {
+			continue
+		}
+		val := subnets.IPToUint32(ip)
+		if _, ok := failed[val]; !ok {
+			failed[val] = false
+		}
+		if !res.Success {
+			if !failed[val] {
+				firstFailure[val] = res
+			}
+			failed[val] = true
+		}
+	}
+	report.Hosts = len(failed)
+	for _, isFailed := range failed {
+		if isFailed {
+			report.FailedHosts++
+		}
+	}
+	hosts := make([]uint32, 0, len(failed))
+	for val := range failed {
+		hosts = append(hosts, val)
+	}
+	sort.Slice(hosts, func(i, j int) bool { return hosts[i] < hosts[j] })
+	badBefore := make([]int, len(hosts)+1)
+	for i, val := range hosts {
+		badBefore[i+1] = badBefore[i]
+		if failed[val] {
+			badBefore[i+1]++
+		}
+	}
+	maskSize, _ := subnet.Network.Mask.Size()
+	if minBlockPrefix < maskSize {
+		minBlockPrefix = maskSize
+	}
+	var walk func(start uint32, prefix int)
+	walk = func(start uint32, prefix int) {
+		size := uint64(1) << uint(32-prefix)
+		lo := sort.Search(len(hosts), func(i int) bool { return uint64(hosts[i]) >= uint64(start) })
+		hi := sort.Search(len(hosts), func(i int) bool { return uint64(hosts[i]) >= uint64(start)+size })
+		probed := hi - lo
+		bad := badBefore[hi] - badBefore[lo]
+		if bad == 0 {
+			return
+		}
+		if bad == probed && bad > 1 {
+			report.FailedBlocks = append(report.FailedBlocks, fmt.Sprintf("%s/%d", subnets.Uint32ToIP(start), prefix))
+			return
+		}
+		if prefix >= minBlockPrefix {
+			for _, val := range hosts[lo:hi] {
+				if failed[val] {
+					report.FailedIPs = append(report.FailedIPs, firstFailure[val])
+				}
+			}
+			return
+		}
+		walk(start, prefix+1)
+		walk(start+uint32(size/2), prefix+1)
+	}
+	walk(subnets.IPToUint32(subnet.Network.IP.To4()), maskSize)
+	return report
+}
+
+func ipLess(a, b string) bool {
+	ipA := net.ParseIP(a).To4()
+	ipB := net.ParseIP(b).To4()
+	if ipA == nil || ipB == nil {
+		return a < b
+	}
+	return subnets.IPToUint32(ipA) < subnets.IPToUint32(ipB)
+}
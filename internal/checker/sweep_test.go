@@ -0,0 +1,83 @@
+package checker
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/thealonlevi/subnet-sentinel/internal/config"
+	"github.com/thealonlevi/subnet-sentinel/internal/httpclient"
+	"github.com/thealonlevi/subnet-sentinel/internal/logging"
+	"github.com/thealonlevi/subnet-sentinel/internal/subnets"
+)
+
+type funcHTTPClient func(source net.IP, url string) (httpclient.Result, error)
+
+func (f funcHTTPClient) Do(ctx context.Context, source net.IP, url string) (httpclient.Result, error) {
+	return f(source, url)
+}
+
+func TestSweepReportsFailedBlocksAndIPs(t *testing.T) {
+	cfg := config.Config{
+		Subnets: []config.SubnetConfig{{CIDR: "10.9.0.0/22", ExcludeHosts: []string{"10.9.1.7"}}},
+		Targets: []string{"https://a.test", "https://b.test"},
+	}
+	subs, err := subnets.FromConfigs(cfg.Subnets)
+	if err != nil {
+		t.Fatalf("subnet parse: %v", err)
+	}
+	client := funcHTTPClient(func(source net.IP, url string) (httpclient.Result, error) {
+		ip := source.To4()
+		if ip[2] == 2 {
+			return httpclient.Result{}, fmt.Errorf("connection refused")
+		}
+		if ip[2] == 1 && ip[3] == 77 && strings.Contains(url, "b.test") {
+			return httpclient.Result{StatusCode: 403}, fmt.Errorf("unexpected status 403")
+		}
+		return httpclient.Result{StatusCode: 200}, nil
+	})
+	logger, err := logging.New("error")
+	if err != nil {
+		t.Fatalf("logger init: %v", err)
+	}
+	chk, err := New(cfg, subs, client, logger)
+	if err != nil {
+		t.Fatalf("checker init: %v", err)
+	}
+	results, err := chk.Sweep(context.Background(), subs[0], SweepOptions{Concurrency: 8})
+	if err != nil {
+		t.Fatalf("sweep: %v", err)
+	}
+	if len(results) != subs[0].Pool.Size()*2 {
+		t.Fatalf("expected %d results, got %d", subs[0].Pool.Size()*2, len(results))
+	}
+	for _, res := range results {
+		if res.SourceIP == "10.9.1.7" {
+			t.Fatalf("excluded host probed")
+		}
+	}
+	report := BuildSweepReport(subs[0], results, 28)
+	if report.Hosts != 1021 {
+		t.Fatalf("expected 1021 hosts, got %d", report.Hosts)
+	}
+	if report.FailedHosts != 257 {
+		t.Fatalf("expected 257 failed hosts, got %d", report.FailedHosts)
+	}
+	if len(report.FailedBlocks) != 1 || report.FailedBlocks[0] != "10.9.2.0/24" {
+		t.Fatalf("expected failed block 10.9.2.0/24, got %v", report.FailedBlocks)
+	}
+	if len(report.FailedIPs) != 1 || report.FailedIPs[0].SourceIP != "10.9.1.77" || report.FailedIPs[0].URL != "https://b.test" {
+		t.Fatalf("expected failed ip 10.9.1.77, got %v", report.FailedIPs)
+	}
+	if results, err := chk.Sweep(context.Background(), subs[0], SweepOptions{Rate: 2e9, Concurrency: 8}); err != nil || len(results) != subs[0].Pool.Size()*2 {
+		t.Fatalf("expected a very high rate to sweep unthrottled, got %d results, %v", len(results), err)
+	}
+	for _, rate := range []float64{math.NaN(), math.Inf(1)} {
+		if _, err := chk.Sweep(context.Background(), subs[0], SweepOptions{Rate: rate}); err == nil {
+			t.Fatalf("expected rate %v to be rejected", rate)
+		}
+	}
+}
@@ -1,29 +1,125 @@
 package config
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"net"
-	"os"
+	"sort"
+	"strings"
 
 	"gopkg.in/yaml.v3"
 )
 
 type SubnetConfig struct {
-	CIDR           string   `yaml:"cidr"`
-	ExcludeHosts   []string `yaml:"excludeHosts"`
-	MountInterface string   `yaml:"mountInterface"`
+	CIDR            string            `yaml:"cidr"`
+	ExcludeHosts    []string          `yaml:"excludeHosts,omitempty"`
+	MountInterface  string            `yaml:"mountInterface,omitempty"`
+	Sampling        SamplingConfig    `yaml:"sampling,omitempty"`
+	Targets         []string          `yaml:"targets,omitempty"`
+	IPsPerSubnet    int               `yaml:"ipsPerSubnet,omitempty"`
+	IntervalSeconds int               `yaml:"intervalSeconds,omitempty"`
+	TimeoutSeconds  int               `yaml:"timeoutSeconds,omitempty"`
+	Tags            map[string]string `yaml:"tags,omitempty"`
+	Source          string            `yaml:"-"`
+}
+
+type SamplingConfig struct {
+	Strategy    string   `yaml:"strategy,omitempty"`
+	BlockPrefix int      `yaml:"blockPrefix,omitempty"`
+	Canaries    []string `yaml:"canaries,omitempty"`
+	CanaryCount int      `yaml:"canaryCount,omitempty"`
 }
 
 type Config struct {
-	Subnets          []SubnetConfig `yaml:"subnets"`
-	Targets          []string       `yaml:"targets"`
-	IPsPerSubnet     int            `yaml:"ipsPerSubnet"`
-	IntervalSeconds  int            `yaml:"intervalSeconds"`
-	AutoMountSubnets bool           `yaml:"autoMountSubnets"`
-	DefaultInterface string         `yaml:"defaultInterface"`
+	Version         int              `yaml:"version"`
+	Include         StringList       `yaml:"include,omitempty"`
+	Subnets         []SubnetConfig   `yaml:"subnets"`
+	Targets         []string         `yaml:"targets"`
+	IPsPerSubnet    int              `yaml:"ipsPerSubnet"`
+	IntervalSeconds int              `yaml:"intervalSeconds"`
+	TimeoutSeconds  int              `yaml:"timeoutSeconds"`
+	Mount           MountConfig      `yaml:"mount"`
+	Coverage        CoverageConfig   `yaml:"coverage"`
+	Localize        LocalizeConfig   `yaml:"localize"`
+	Seed            *int64           `yaml:"seed,omitempty"`
+	Quarantine      QuarantineConfig `yaml:"quarantine"`
+	Logging         LoggingConfig    `yaml:"logging"`
+	Thresholds      ThresholdsConfig `yaml:"thresholds"`
+	Metrics         MetricsConfig    `yaml:"metrics"`
+}
+
+type MetricsConfig struct {
+	Listen string `yaml:"listen"`
+}
+
+type ThresholdsConfig struct {
+	WarningPercent  *float64 `yaml:"warningPercent,omitempty"`
+	CriticalPercent *float64 `yaml:"criticalPercent,omitempty"`
+}
+
+type LoggingConfig struct {
+	Outputs StringList    `yaml:"outputs"`
+	Tag     string        `yaml:"tag"`
+	File    LogFileConfig `yaml:"file"`
+	Syslog  SyslogConfig  `yaml:"syslog"`
+}
+
+type LogFileConfig struct {
+	Path        string `yaml:"path"`
+	MaxSizeMB   int    `yaml:"maxSizeMB"`
+	MaxAgeHours int    `yaml:"maxAgeHours"`
+	MaxBackups  int    `yaml:"maxBackups"`
+	Compress    bool   `yaml:"compress"`
+}
+
+type SyslogConfig struct {
+	Network  string `yaml:"network"`
+	Address  string `yaml:"address"`
+	Facility string `yaml:"facility"`
+}
+
+type MountConfig struct {
+	Auto             bool   `yaml:"auto"`
+	DefaultInterface string `yaml:"defaultInterface"`
+}
+
+type QuarantineConfig struct {
+	Enabled          bool   `yaml:"enabled"`
+	File             string `yaml:"file"`
+	FailureThreshold int    `yaml:"failureThreshold"`
+	ReleaseAfter     int    `yaml:"releaseAfter"`
+	RetestPerRun     int    `yaml:"retestPerRun"`
+}
+
+type LocalizeConfig struct {
+	Enabled     bool `yaml:"enabled"`
+	BlockPrefix int  `yaml:"blockPrefix"`
+	Samples     int  `yaml:"samples"`
+}
+
+type CoverageConfig struct {
+	File           string `yaml:"file"`
+	WindowHours    int    `yaml:"windowHours"`
+	RetentionHours int    `yaml:"retentionHours"`
 }
 
+const (
+	SamplingRandom      = "random"
+	SamplingStratified  = "stratified"
+	SamplingSweep       = "sweep"
+	SamplingSticky      = "sticky"
+	SamplingLeastRecent = "least-recent"
+)
+
+const (
+	LogOutputStdout   = "stdout"
+	LogOutputFile     = "file"
+	LogOutputSyslog   = "syslog"
+	LogOutputJournald = "journald"
+)
+
 var defaultTargets = []string{
 	"https://google.com",
 	"https://ipinfo.io",
@@ -31,19 +127,29 @@ var defaultTargets = []string{
 }
 
 func Load(path string) (Config, error) {
-	data, err := os.ReadFile(path)
-	if err != nil {
-		return Config{}, fmt.Errorf("read config: %w", err)
+	return LoadWithOptions(path, LoadOptions{})
+}
+
+func LoadWithOptions(path string, opts LoadOptions) (Config, error) {
+	d := Diagnose(path, opts)
+	if err := d.Err(); err != nil {
+		return Config{}, err
 	}
-	var cfg Config
-	if err := yaml.Unmarshal(data, &cfg); err != nil {
-		return Config{}, fmt.Errorf("parse config: %w", err)
+	if opts.Warn != nil {
+		for _, item := range d.Items {
+			opts.Warn(item.summary())
+		}
 	}
-	cfg.applyDefaults()
-	if err := cfg.Validate(); err != nil {
-		return Config{}, err
+	return d.Config, nil
+}
+
+func (c Config) Hash() (string, error) {
+	data, err := yaml.Marshal(c)
+	if err != nil {
+		return "", fmt.Errorf("encode config: %w", err)
 	}
-	return cfg, nil
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
 }
 
 func (c *Config) applyDefaults() {
@@ -56,41 +162,241 @@ func (c *Config) applyDefaults() {
 	if c.IntervalSeconds == 0 {
 		c.IntervalSeconds = 60
 	}
+	if c.TimeoutSeconds == 0 {
+		c.TimeoutSeconds = 15
+	}
+	if c.Coverage.WindowHours == 0 {
+		c.Coverage.WindowHours = 24
+	}
+	if c.Localize.BlockPrefix == 0 {
+		c.Localize.BlockPrefix = 24
+	}
+	if c.Localize.Samples == 0 {
+		c.Localize.Samples = 4
+	}
+	if c.Quarantine.FailureThreshold == 0 {
+		c.Quarantine.FailureThreshold = 3
+	}
+	if c.Quarantine.ReleaseAfter == 0 {
+		c.Quarantine.ReleaseAfter = 3
+	}
+	if c.Thresholds.WarningPercent == nil {
+		warning := 100.0
+		c.Thresholds.WarningPercent = &warning
+	}
+	if c.Thresholds.CriticalPercent == nil {
+		critical := 0.0
+		c.Thresholds.CriticalPercent = &critical
+	}
+	if len(c.Logging.Outputs) == 0 {
+		c.Logging.Outputs = StringList{LogOutputStdout}
+	}
+	if c.Logging.Tag == "" {
+		c.Logging.Tag = "subnet-sentinel"
+	}
+	if c.Logging.File.MaxSizeMB == 0 {
+		c.Logging.File.MaxSizeMB = 100
+	}
+	if c.Logging.File.MaxBackups == 0 {
+		c.Logging.File.MaxBackups = 5
+	}
+	if c.Logging.Syslog.Network == "" {
+		c.Logging.Syslog.Network = "udp"
+	}
+	if c.Logging.Syslog.Address == "" {
+		if c.Logging.Syslog.Network == "unix" {
+			c.Logging.Syslog.Address = "/dev/log"
+		} else {
+			c.Logging.Syslog.Address = "localhost:514"
+		}
+	}
+	if c.Logging.Syslog.Facility == "" {
+		c.Logging.Syslog.Facility = "daemon"
+	}
+}
+
+type Problem struct {
+	Path    string
+	Message string
+	Warning bool
 }
 
 func (c Config) Validate() error {
-	if len(c.Subnets) == 0 {
-		return errors.New("no subnets configured")
+	for _, problem := range c.Problems() {
+		if !problem.Warning {
+			return errors.New(problem.Message)
+		}
 	}
-	if c.IPsPerSubnet < 0 {
-		return errors.New("ipsPerSubnet must be positive")
+	return nil
+}
+
+func (c Config) Problems() []Problem {
+	problems := make([]Problem, 0)
+	add := func(path string, format string, args ...any) {
+		problems = append(problems, Problem{Path: path, Message: fmt.Sprintf(format, args...)})
 	}
-	if c.IPsPerSubnet == 0 {
-		return errors.New("ipsPerSubnet must be positive")
+	if len(c.Subnets) == 0 {
+		add("subnets", "no subnets configured")
+	}
+	if c.IPsPerSubnet <= 0 {
+		add("ipsPerSubnet", "ipsPerSubnet must be positive")
 	}
 	if c.IntervalSeconds < 0 {
-		return errors.New("intervalSeconds must be non-negative")
+		add("intervalSeconds", "intervalSeconds must be non-negative")
 	}
-	for i, subnet := range c.Subnets {
-		if subnet.CIDR == "" {
-			return fmt.Errorf("subnet %d missing cidr", i)
+	if c.TimeoutSeconds < 0 {
+		add("timeoutSeconds", "timeoutSeconds must be positive")
+	}
+	if c.Coverage.WindowHours < 0 {
+		add("coverage.windowHours", "coverage.windowHours must be non-negative")
+	}
+	if c.Coverage.RetentionHours < 0 {
+		add("coverage.retentionHours", "coverage.retentionHours must be non-negative")
+	}
+	if c.Localize.BlockPrefix < 0 || c.Localize.BlockPrefix > 32 {
+		add("localize.blockPrefix", "localize.blockPrefix must be between 0 and 32")
+	}
+	if c.Localize.Samples < 0 {
+		add("localize.samples", "localize.samples must be non-negative")
+	}
+	if c.Quarantine.FailureThreshold < 0 {
+		add("quarantine.failureThreshold", "quarantine.failureThreshold must be positive")
+	}
+	if c.Quarantine.ReleaseAfter < 0 {
+		add("quarantine.releaseAfter", "quarantine.releaseAfter must be positive")
+	}
+	if c.Quarantine.RetestPerRun < 0 {
+		add("quarantine.retestPerRun", "quarantine.retestPerRun must be non-negative")
+	}
+	if c.Metrics.Listen != "" {
+		if _, _, err := net.SplitHostPort(c.Metrics.Listen); err != nil {
+			add("metrics.listen", "invalid metrics.listen %s, expected host:port", c.Metrics.Listen)
 		}
-		ip, ipNet, err := net.ParseCIDR(subnet.CIDR)
-		if err != nil {
-			return fmt.Errorf("subnet %s invalid cidr: %w", subnet.CIDR, err)
+	}
+	if warning := c.Thresholds.WarningPercent; warning != nil && (*warning < 0 || *warning > 100) {
+		add("thresholds.warningPercent", "thresholds.warningPercent must be between 0 and 100")
+	}
+	if critical := c.Thresholds.CriticalPercent; critical != nil && (*critical < 0 || *critical > 100) {
+		add("thresholds.criticalPercent", "thresholds.criticalPercent must be between 0 and 100")
+	}
+	if warning, critical := c.Thresholds.WarningPercent, c.Thresholds.CriticalPercent; warning != nil && critical != nil && *critical > *warning {
+		add("thresholds.criticalPercent", "thresholds.criticalPercent must not exceed thresholds.warningPercent")
+	}
+	for i, output := range c.Logging.Outputs {
+		switch output {
+		case LogOutputStdout, LogOutputSyslog, LogOutputJournald:
+		case LogOutputFile:
+			if c.Logging.File.Path == "" {
+				add("logging.file.path", "logging.file.path is required for the file output")
+			}
+		default:
+			add(fmt.Sprintf("logging.outputs[%d]", i), "unknown logging output %s, expected stdout, file, syslog or journald", output)
 		}
-		if ip.To4() == nil || len(ipNet.Mask) != net.IPv4len {
-			return fmt.Errorf("subnet %s must be ipv4", subnet.CIDR)
+	}
+	if c.Logging.File.MaxSizeMB < 0 || c.Logging.File.MaxAgeHours < 0 || c.Logging.File.MaxBackups < 0 {
+		add("logging.file", "logging.file limits must be non-negative")
+	}
+	switch c.Logging.Syslog.Network {
+	case "", "udp", "tcp", "unix":
+	default:
+		add("logging.syslog.network", "logging.syslog.network must be udp, tcp or unix")
+	}
+	for i, subnet := range c.Subnets {
+		path := fmt.Sprintf("subnets[%d]", i)
+		if subnet.CIDR == "" {
+			add(path, "subnet %d missing cidr", i)
+		} else if ip, ipNet, err := net.ParseCIDR(subnet.CIDR); err != nil {
+			add(path+".cidr", "subnet %s invalid cidr: %v", subnet.CIDR, err)
+		} else if ip.To4() == nil || len(ipNet.Mask) != net.IPv4len {
+			add(path+".cidr", "subnet %s must be ipv4", subnet.CIDR)
 		}
-		for _, host := range subnet.ExcludeHosts {
+		for j, host := range subnet.ExcludeHosts {
 			hostIP := net.ParseIP(host)
 			if hostIP == nil || hostIP.To4() == nil {
-				return fmt.Errorf("subnet %s has invalid exclude host %s", subnet.CIDR, host)
+				add(fmt.Sprintf("%s.excludeHosts[%d]", path, j), "subnet %s has invalid exclude host %s", subnet.CIDR, host)
 			}
 		}
+		if subnet.IPsPerSubnet < 0 {
+			add(path+".ipsPerSubnet", "subnet %s ipsPerSubnet must be positive", subnet.CIDR)
+		}
+		if subnet.IntervalSeconds < 0 {
+			add(path+".intervalSeconds", "subnet %s intervalSeconds must be non-negative", subnet.CIDR)
+		}
+		if subnet.TimeoutSeconds < 0 {
+			add(path+".timeoutSeconds", "subnet %s timeoutSeconds must be positive", subnet.CIDR)
+		}
+		for j, target := range subnet.Targets {
+			if target == "" {
+				add(fmt.Sprintf("%s.targets[%d]", path, j), "subnet %s has empty target", subnet.CIDR)
+			}
+		}
+		keys := make([]string, 0, len(subnet.Tags))
+		for key := range subnet.Tags {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		labels := make(map[string]string, len(keys))
+		for _, key := range keys {
+			if key == "" {
+				add(path+".tags", "subnet %s has empty tag key", subnet.CIDR)
+				continue
+			}
+			name := TagLabel(key)
+			if other, ok := labels[name]; ok {
+				add(path+".tags", "subnet %s tags %q and %q both map to metrics label %s", subnet.CIDR, other, key, name)
+			}
+			labels[name] = key
+		}
+		if err := subnet.Sampling.Validate(); err != nil {
+			add(path+".sampling", "subnet %s sampling: %v", subnet.CIDR, err)
+		}
 	}
 	if len(c.Targets) == 0 {
-		return errors.New("no targets configured")
+		add("targets", "no targets configured")
+	}
+	return append(problems, subnetConflicts(c.Subnets)...)
+}
+
+func TagLabel(key string) string {
+	var b strings.Builder
+	b.WriteString("tag_")
+	for _, r := range key {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '_' {
+			b.WriteRune(r)
+		} else {
+			b.WriteByte('_')
+		}
+	}
+	return b.String()
+}
+
+func (s SamplingConfig) Validate() error {
+	switch s.Strategy {
+	case "", SamplingRandom, SamplingStratified, SamplingSweep, SamplingSticky, SamplingLeastRecent:
+	default:
+		return fmt.Errorf("unknown strategy %s", s.Strategy)
+	}
+	if s.BlockPrefix < 0 || s.BlockPrefix > 32 {
+		return fmt.Errorf("blockPrefix must be between 0 and 32")
+	}
+	if s.CanaryCount < 0 {
+		return errors.New("canaryCount must be non-negative")
+	}
+	for _, host := range s.Canaries {
+		hostIP := net.ParseIP(host)
+		if hostIP == nil || hostIP.To4() == nil {
+			return fmt.Errorf("invalid canary %s", host)
+		}
 	}
 	return nil
 }
+
+func (c Config) MaxTimeoutSeconds() int {
+	max := c.TimeoutSeconds
+	for _, subnet := range c.Subnets {
+		if subnet.TimeoutSeconds > max {
+			max = subnet.TimeoutSeconds
+		}
+	}
+	return max
+}
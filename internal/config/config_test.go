@@ -0,0 +1,463 @@
+package config
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func writeFile(t *testing.T, path string, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("write %s: %v", path, err)
+	}
+}
+
+func TestLoadMergesDropIns(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "config.yaml"), `include: conf.d/*.yaml
+subnets:
+  - cidr: 10.0.0.0/24
+targets:
+  - https://a.test
+`)
+	writeFile(t, filepath.Join(dir, "conf.d", "acme.yaml"), `subnets:
+  - cidr: 10.1.0.0/24
+    tags:
+      customer: acme
+targets:
+  - https://a.test
+  - https://acme.test
+`)
+	writeFile(t, filepath.Join(dir, "conf.d", "globex.yaml"), `subnets:
+  - cidr: 10.2.0.0/24
+`)
+	cfg, err := Load(filepath.Join(dir, "config.yaml"))
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if len(cfg.Subnets) != 3 {
+		t.Fatalf("expected 3 subnets, got %d", len(cfg.Subnets))
+	}
+	if cfg.Subnets[1].CIDR != "10.1.0.0/24" || cfg.Subnets[1].Tags["customer"] != "acme" {
+		t.Fatalf("unexpected drop-in subnet %+v", cfg.Subnets[1])
+	}
+	if !strings.HasSuffix(cfg.Subnets[2].Source, filepath.Join("conf.d", "globex.yaml")+":2") {
+		t.Fatalf("unexpected source %s", cfg.Subnets[2].Source)
+	}
+	if strings.Join(cfg.Targets, ",") != "https://a.test,https://acme.test" {
+		t.Fatalf("unexpected targets %v", cfg.Targets)
+	}
+}
+
+func TestLoadReportsDropInConflicts(t *testing.T) {
+	cases := []struct {
+		name     string
+		dropIn   string
+		expected []string
+	}{
+		{
+			name:     "duplicate",
+			dropIn:   "subnets:\n  - cidr: 10.9.0.0/24\n  - cidr: 10.0.0.0/24\n",
+			expected: []string{"duplicate subnet 10.0.0.0/24", "b.yaml:3", "config.yaml:3"},
+		},
+		{
+			name:     "overlap",
+			dropIn:   "subnets:\n  - cidr: 10.0.0.128/25\n",
+			expected: []string{"overlapping subnets", "10.0.0.128/25", "b.yaml:2", "config.yaml:3"},
+		},
+		{
+			name:     "unsupported key",
+			dropIn:   "ipsPerSubnet: 3\n",
+			expected: []string{"b.yaml:1", "ipsPerSubnet is not allowed"},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFile(t, filepath.Join(dir, "config.yaml"), "include: conf.d/*.yaml\nsubnets:\n  - cidr: 10.0.0.0/24\n")
+			writeFile(t, filepath.Join(dir, "conf.d", "b.yaml"), tc.dropIn)
+			_, err := Load(filepath.Join(dir, "config.yaml"))
+			if err == nil {
+				t.Fatalf("expected error")
+			}
+			for _, part := range tc.expected {
+				if !strings.Contains(err.Error(), part) {
+					t.Fatalf("expected error %q to contain %q", err.Error(), part)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadWarnsOnOverlapsWithinOneFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	writeFile(t, path, "include: conf.d/*.yaml\nsubnets:\n  - cidr: 10.0.0.0/24\n  - cidr: 10.0.0.0/25\n")
+	writeFile(t, filepath.Join(dir, "conf.d", "b.yaml"), "subnets:\n  - cidr: 10.1.0.0/16\n  - cidr: 10.1.2.0/24\n")
+	warnings := make([]string, 0)
+	if _, err := LoadWithOptions(path, LoadOptions{Warn: func(message string) { warnings = append(warnings, message) }}); err != nil {
+		t.Fatalf("expected overlaps within one file to load, got %v", err)
+	}
+	if len(warnings) != 2 || !strings.Contains(warnings[0], "config.yaml:4: overlapping subnets in one file") || !strings.Contains(warnings[1], "b.yaml:3: overlapping subnets in one file") {
+		t.Fatalf("expected a warning per overlap, got %v", warnings)
+	}
+	writeFile(t, filepath.Join(dir, "conf.d", "c.yaml"), "subnets:\n  - cidr: 10.1.2.128/25\n")
+	_, err := Load(path)
+	if err == nil || !strings.Contains(err.Error(), "10.1.2.128/25") || !strings.Contains(err.Error(), "b.yaml:3") {
+		t.Fatalf("expected overlap across files to name the closest enclosing subnet, got %v", err)
+	}
+	writeFile(t, filepath.Join(dir, "conf.d", "c.yaml"), "subnets:\n  - cidr: 10.1.0.0/16\n  - cidr: 10.1.0.0/16\n")
+	writeFile(t, filepath.Join(dir, "conf.d", "b.yaml"), "subnets: []\n")
+	_, err = Load(path)
+	if err == nil || !strings.Contains(err.Error(), "c.yaml:3: duplicate subnet 10.1.0.0/16") {
+		t.Fatalf("expected duplicates within one file to be rejected, got %v", err)
+	}
+}
+
+func TestLoadAppliesOverridePrecedence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeFile(t, path, `subnets:
+  - cidr: 10.0.0.0/24
+ipsPerSubnet: 3
+intervalSeconds: 30
+timeoutSeconds: 20
+`)
+	cfg, err := LoadWithOptions(path, LoadOptions{
+		Environ: []string{
+			"SUBNET_SENTINEL_IPS_PER_SUBNET=7",
+			"SUBNET_SENTINEL_INTERVAL_SECONDS=45",
+			"SUBNET_SENTINEL_LOCALIZE_ENABLED=true",
+			"SUBNET_SENTINEL_QUARANTINE_FILE=/tmp/q.json",
+			"UNRELATED=1",
+		},
+		Overrides: map[string]string{
+			"ipsPerSubnet": "9",
+			"seed":         "42",
+		},
+	})
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if cfg.IPsPerSubnet != 9 {
+		t.Fatalf("expected flag to win over env, got %d", cfg.IPsPerSubnet)
+	}
+	if cfg.IntervalSeconds != 45 {
+		t.Fatalf("expected env to win over file, got %d", cfg.IntervalSeconds)
+	}
+	if cfg.TimeoutSeconds != 20 {
+		t.Fatalf("expected file value to be kept, got %d", cfg.TimeoutSeconds)
+	}
+	if !cfg.Localize.Enabled || cfg.Quarantine.File != "/tmp/q.json" {
+		t.Fatalf("expected nested env overrides applied, got %+v %+v", cfg.Localize, cfg.Quarantine)
+	}
+	if cfg.Seed == nil || *cfg.Seed != 42 {
+		t.Fatalf("expected seed override, got %v", cfg.Seed)
+	}
+	_, err = LoadWithOptions(path, LoadOptions{Environ: []string{"SUBNET_SENTINEL_IPS_PER_SUBNET=many"}})
+	if err == nil || !strings.Contains(err.Error(), "ipsPerSubnet") {
+		t.Fatalf("expected invalid override error naming the field, got %v", err)
+	}
+}
+
+func TestLoadRejectsUnknownKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeFile(t, path, "subnets:\n  - cidr: 10.0.0.0/24\nipsPerSubent: 20\n")
+	_, err := Load(path)
+	if err == nil {
+		t.Fatalf("expected unknown key error")
+	}
+	for _, part := range []string{"config.yaml:3", "unknown key ipsPerSubent", "did you mean ipsPerSubnet?"} {
+		if !strings.Contains(err.Error(), part) {
+			t.Fatalf("expected error %q to contain %q", err.Error(), part)
+		}
+	}
+	cfg, err := LoadWithOptions(path, LoadOptions{AllowUnknownKeys: true})
+	if err != nil {
+		t.Fatalf("load with unknown keys allowed: %v", err)
+	}
+	if cfg.IPsPerSubnet != 5 {
+		t.Fatalf("expected default ipsPerSubnet, got %d", cfg.IPsPerSubnet)
+	}
+}
+
+func TestClosestField(t *testing.T) {
+	cases := map[string]string{
+		"ipsPerSubent":   "ipsPerSubnet",
+		"IPsPerSubnet":   "ipsPerSubnet",
+		"timeout":        "",
+		"intervalSecond": "intervalSeconds",
+		"zzz":            "",
+	}
+	for name, expected := range cases {
+		if got := closestField(reflect.TypeOf(Config{}), name); got != expected {
+			t.Fatalf("closestField(%s) = %q, expected %q", name, got, expected)
+		}
+	}
+}
+
+func TestLoadRejectsCollidingTagLabels(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeFile(t, path, "subnets:\n  - cidr: 10.0.0.0/24\n    tags:\n      pop-x: fra\n      pop_x: ams\n      pop.y: fra\n")
+	_, err := Load(path)
+	if err == nil || !strings.Contains(err.Error(), `tags "pop-x" and "pop_x" both map to metrics label tag_pop_x`) {
+		t.Fatalf("expected colliding tag keys to be rejected, got %v", err)
+	}
+	if got := TagLabel("pop.y-1"); got != "tag_pop_y_1" {
+		t.Fatalf("TagLabel = %q", got)
+	}
+}
+
+func TestLoadFormatsAreEquivalent(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"config.yaml": `subnets:
+  - cidr: 10.0.0.0/24
+    tags:
+      customer: acme
+    sampling:
+      strategy: sticky
+      canaries: [10.0.0.9]
+  - cidr: 10.1.0.0/24
+ipsPerSubnet: 2
+localize:
+  enabled: true
+`,
+		"config.json": `{
+  "subnets": [
+    {"cidr": "10.0.0.0/24", "tags": {"customer": "acme"}, "sampling": {"strategy": "sticky", "canaries": ["10.0.0.9"]}},
+    {"cidr": "10.1.0.0/24"}
+  ],
+  "ipsPerSubnet": 2,
+  "localize": {"enabled": true}
+}
+`,
+		"config.toml": `ipsPerSubnet = 2
+localize.enabled = true
+
+[[subnets]]
+cidr = "10.0.0.0/24"
+tags = { customer = "acme" }
+
+[subnets.sampling]
+strategy = "sticky"
+canaries = ["10.0.0.9"]
+
+[[subnets]]
+cidr = "10.1.0.0/24"
+`,
+	}
+	var expected Config
+	for _, name := range []string{"config.yaml", "config.json", "config.toml"} {
+		path := filepath.Join(dir, name)
+		writeFile(t, path, files[name])
+		cfg, err := Load(path)
+		if err != nil {
+			t.Fatalf("load %s: %v", name, err)
+		}
+		for i := range cfg.Subnets {
+			cfg.Subnets[i].Source = ""
+		}
+		if name == "config.yaml" {
+			expected = cfg
+			continue
+		}
+		if !reflect.DeepEqual(cfg, expected) {
+			t.Fatalf("%s decoded to %+v, expected %+v", name, cfg, expected)
+		}
+	}
+	typo := filepath.Join(dir, "typo.toml")
+	writeFile(t, typo, "[[subnets]]\ncidr = \"10.0.0.0/24\"\ncidrr = \"10.1.0.0/24\"\n")
+	_, err := Load(typo)
+	if err == nil || !strings.Contains(err.Error(), "typo.toml:3: unknown key subnets[0].cidrr") {
+		t.Fatalf("expected toml unknown key error with line, got %v", err)
+	}
+}
+
+func TestLoadJSONEscapes(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.json")
+	writeFile(t, path, `{
+  "subnets": [{"cidr": "10.0.0.0\/24", "tags": {"customer": "acme \"east\"", "site": "\u0041\u00e9\ttab"}}],
+  "targets": ["https:\/\/a.test\/health"]
+}
+`)
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if cfg.Subnets[0].CIDR != "10.0.0.0/24" || cfg.Targets[0] != "https://a.test/health" {
+		t.Fatalf("unexpected values %+v", cfg)
+	}
+	if tags := cfg.Subnets[0].Tags; tags["customer"] != `acme "east"` || tags["site"] != "A\u00e9\ttab" {
+		t.Fatalf("unexpected tags %q", tags)
+	}
+	writeFile(t, path, "{\n  \"subnets\": [{\"cidr\": \"10.0.0.0\\/24\", \"cidrr\": \"x\"}]\n}\n")
+	if _, err := Load(path); err == nil || !strings.Contains(err.Error(), "config.json:2: unknown key subnets[0].cidrr") {
+		t.Fatalf("expected unknown key error with line, got %v", err)
+	}
+	writeFile(t, path, "{\n  \"seed\": 1,\n  \"targets\": [\"a\" \"b\"]\n}\n")
+	if _, err := Load(path); err == nil || !strings.Contains(err.Error(), "config.json:3:") {
+		t.Fatalf("expected syntax error with line, got %v", err)
+	}
+}
+
+func TestConvertRoundTrips(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "config.yaml")
+	writeFile(t, source, "subnets:\n  - cidr: 10.0.0.0/24\n    tags:\n      customer: acme\n    sampling:\n      strategy: stratified\ntargets: [https://a.test]\nseed: 7\n")
+	original, err := Load(source)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	path := source
+	for _, format := range []string{FormatTOML, FormatJSON, FormatYAML} {
+		var buf strings.Builder
+		if err := Convert(path, "", format, &buf); err != nil {
+			t.Fatalf("convert to %s: %v", format, err)
+		}
+		path = filepath.Join(dir, "converted."+format)
+		writeFile(t, path, buf.String())
+		cfg, err := Load(path)
+		if err != nil {
+			t.Fatalf("load converted %s: %v\n%s", format, err, buf.String())
+		}
+		cfg.Subnets[0].Source = original.Subnets[0].Source
+		if !reflect.DeepEqual(cfg, original) {
+			t.Fatalf("%s round trip changed config: %+v", format, cfg)
+		}
+	}
+}
+
+func TestLoadMigratesVersionOneConfig(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	writeFile(t, path, "subnets:\n  - cidr: 10.0.0.0/24\nautoMountSubnets: true\ndefaultInterface: eth0\n")
+	warnings := make([]string, 0)
+	cfg, err := LoadWithOptions(path, LoadOptions{Warn: func(message string) { warnings = append(warnings, message) }})
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if cfg.Version != CurrentVersion || !cfg.Mount.Auto || cfg.Mount.DefaultInterface != "eth0" {
+		t.Fatalf("unexpected migrated config %+v", cfg)
+	}
+	if len(warnings) != 2 || !strings.Contains(warnings[0], "config.yaml:3: autoMountSubnets is deprecated, use mount.auto") {
+		t.Fatalf("unexpected warnings %v", warnings)
+	}
+
+	data, from, err := Migrate(path, "")
+	if err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	if from != 1 {
+		t.Fatalf("expected migration from version 1, got %d", from)
+	}
+	migrated := filepath.Join(dir, "migrated.yaml")
+	writeFile(t, migrated, string(data))
+	warnings = warnings[:0]
+	again, err := LoadWithOptions(migrated, LoadOptions{Warn: func(message string) { warnings = append(warnings, message) }})
+	if err != nil {
+		t.Fatalf("load migrated: %v\n%s", err, data)
+	}
+	if len(warnings) != 0 || again.Mount != cfg.Mount {
+		t.Fatalf("migrated file still deprecated: %v %+v", warnings, again.Mount)
+	}
+
+	writeFile(t, path, "version: 3\nsubnets:\n  - cidr: 10.0.0.0/24\n")
+	if _, err := Load(path); err == nil || !strings.Contains(err.Error(), "newer than the supported version") {
+		t.Fatalf("expected future version error, got %v", err)
+	}
+	writeFile(t, path, "version: 2\nsubnets:\n  - cidr: 10.0.0.0/24\ndefaultInterface: eth0\n")
+	if _, err := Load(path); err == nil || !strings.Contains(err.Error(), "unknown key defaultInterface") {
+		t.Fatalf("expected version 2 to reject old keys, got %v", err)
+	}
+}
+
+func TestSchemaMatchesPublishedFile(t *testing.T) {
+	generated, err := Schema()
+	if err != nil {
+		t.Fatalf("schema: %v", err)
+	}
+	published, err := os.ReadFile(filepath.Join("..", "..", "examples", "config.schema.json"))
+	if err != nil {
+		t.Fatalf("read published schema: %v", err)
+	}
+	if string(generated) != string(published) {
+		t.Fatalf("examples/config.schema.json is stale, regenerate it with subnet-sentinel config schema")
+	}
+	var schema map[string]any
+	if err := json.Unmarshal(generated, &schema); err != nil {
+		t.Fatalf("decode schema: %v", err)
+	}
+	for _, field := range ScalarFields() {
+		node := schema
+		for _, name := range strings.Split(field.Path, ".") {
+			properties, _ := node["properties"].(map[string]any)
+			child, ok := properties[name].(map[string]any)
+			if !ok {
+				t.Fatalf("schema is missing %s", field.Path)
+			}
+			node = child
+		}
+	}
+	properties := schema["properties"].(map[string]any)
+	if versions, _ := properties["version"].(map[string]any)["enum"].([]any); len(versions) != CurrentVersion {
+		t.Fatalf("expected every supported version in the schema, got %v", versions)
+	}
+	for _, key := range []string{"autoMountSubnets", "defaultInterface"} {
+		if deprecated, _ := properties[key].(map[string]any)["deprecated"].(bool); !deprecated {
+			t.Fatalf("expected %s to be accepted as deprecated", key)
+		}
+	}
+}
+
+func TestLoadAndDiagnoseShareOnePipeline(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	writeFile(t, path, "subnets:\n  - cidr: 10.0.0.0/24\nipsPerSubent: 20\nintervalSeconds: soon\n")
+	diags := Diagnose(path, LoadOptions{AllowUnknownKeys: true})
+	if diags.Count(SeverityWarning) != 1 || diags.Count(SeverityError) != 1 {
+		t.Fatalf("unexpected diagnostics %v", diags.Items)
+	}
+	warnings := make([]string, 0)
+	_, err := LoadWithOptions(path, LoadOptions{AllowUnknownKeys: true, Warn: func(message string) { warnings = append(warnings, message) }})
+	if err == nil || err.Error() != diags.Err().Error() || !strings.HasPrefix(err.Error(), path+":4: ") {
+		t.Fatalf("expected load to fail with the first diagnostic, got %v", err)
+	}
+	writeFile(t, path, "subnets:\n  - cidr: 10.0.0.0/24\nipsPerSubent: 20\n")
+	if _, err := LoadWithOptions(path, LoadOptions{AllowUnknownKeys: true, Warn: func(message string) { warnings = append(warnings, message) }}); err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if len(warnings) != 1 || !strings.HasPrefix(warnings[0], path+":3: unknown key ipsPerSubent") {
+		t.Fatalf("expected unknown key warning, got %v", warnings)
+	}
+}
+
+func TestLoadAcceptsDeprecatedEnvNames(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeFile(t, path, "version: 2\nsubnets:\n  - cidr: 10.0.0.0/24\n")
+	warnings := make([]string, 0)
+	cfg, err := LoadWithOptions(path, LoadOptions{
+		Environ: []string{
+			"SUBNET_SENTINEL_AUTO_MOUNT_SUBNETS=true",
+			"SUBNET_SENTINEL_DEFAULT_INTERFACE=eth0",
+			"SUBNET_SENTINEL_MOUNT_DEFAULT_INTERFACE=eth1",
+		},
+		Warn: func(message string) { warnings = append(warnings, message) },
+	})
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if !cfg.Mount.Auto || cfg.Mount.DefaultInterface != "eth1" {
+		t.Fatalf("expected deprecated names applied below the new ones, got %+v", cfg.Mount)
+	}
+	if len(warnings) != 2 || warnings[1] != "SUBNET_SENTINEL_DEFAULT_INTERFACE is deprecated, use SUBNET_SENTINEL_MOUNT_DEFAULT_INTERFACE" {
+		t.Fatalf("unexpected warnings %v", warnings)
+	}
+}
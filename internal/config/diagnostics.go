@@ -0,0 +1,282 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+type Position struct {
+	File   string `json:"file,omitempty"`
+	Line   int    `json:"line,omitempty"`
+	Column int    `json:"column,omitempty"`
+}
+
+type Diagnostic struct {
+	Position
+	Severity string `json:"severity"`
+	Path     string `json:"path,omitempty"`
+	Message  string `json:"message"`
+}
+
+func (d Diagnostic) String() string {
+	location := d.File
+	if d.Line > 0 {
+		location = fmt.Sprintf("%s:%d", d.File, d.Line)
+	}
+	if d.Column > 0 {
+		location = fmt.Sprintf("%s:%d", location, d.Column)
+	}
+	if location == "" {
+		location = "<overrides>"
+	}
+	return fmt.Sprintf("%s: %s: %s", location, d.Severity, d.Message)
+}
+
+type Diagnostics struct {
+	Config       Config
+	Items        []Diagnostic
+	file         string
+	positions    map[string]Position
+	subnetCount  int
+	targets      []string
+	allowUnknown bool
+}
+
+var lineNumber = regexp.MustCompile(`line (\d+)`)
+
+func Diagnose(path string, opts LoadOptions) *Diagnostics {
+	d := &Diagnostics{file: path, positions: make(map[string]Position), allowUnknown: opts.AllowUnknownKeys}
+	root, err := readDocument(path, opts.Format)
+	if err != nil {
+		d.addError(path, err)
+		return d
+	}
+	from, deprecations, err := migrateDocument(root)
+	if err != nil {
+		d.addError(path, err)
+		return d
+	}
+	for _, deprecation := range deprecations {
+		d.Items = append(d.Items, Diagnostic{
+			Position: Position{File: path, Line: deprecation.Line, Column: deprecation.Column},
+			Severity: SeverityWarning,
+			Message:  fmt.Sprintf("%s (config version %d, run config migrate)", deprecation.Message, from),
+		})
+	}
+	d.index(path, "", root)
+	d.unknownKeys(path, root, reflect.TypeOf(Config{}), "")
+	if err := root.Decode(&d.Config); err != nil {
+		d.addError(path, err)
+	}
+	setSubnetSources(path, root, d.Config.Subnets)
+	d.subnetCount = len(d.Config.Subnets)
+	d.targets = append(d.targets, d.Config.Targets...)
+	matches, err := d.Config.includePaths(path)
+	if err != nil {
+		d.Add(SeverityError, "include", err.Error())
+	}
+	for _, match := range matches {
+		d.mergeDropIn(match)
+	}
+	for _, field := range deprecatedEnv(opts.Environ) {
+		d.Items = append(d.Items, Diagnostic{
+			Severity: SeverityWarning,
+			Message:  fmt.Sprintf("%s is deprecated, use %s", field.Env, Replacement(field).Env),
+		})
+	}
+	if err := d.Config.ApplyOverrides(EnvOverrides(opts.Environ), "environment"); err != nil {
+		d.Items = append(d.Items, Diagnostic{Severity: SeverityError, Message: err.Error()})
+	}
+	if err := d.Config.ApplyOverrides(opts.Overrides, "flag"); err != nil {
+		d.Items = append(d.Items, Diagnostic{Severity: SeverityError, Message: err.Error()})
+	}
+	d.Config.applyDefaults()
+	for _, problem := range d.Config.Problems() {
+		severity := SeverityError
+		if problem.Warning {
+			severity = SeverityWarning
+		}
+		d.Add(severity, problem.Path, problem.Message)
+	}
+	return d
+}
+
+func (d *Diagnostics) Err() error {
+	for _, item := range d.Items {
+		if item.Severity == SeverityError {
+			return errors.New(item.summary())
+		}
+	}
+	return nil
+}
+
+func (d Diagnostic) summary() string {
+	if d.Line > 0 {
+		return fmt.Sprintf("%s:%d: %s", d.File, d.Line, d.Message)
+	}
+	return d.Message
+}
+
+func (d *Diagnostics) mergeDropIn(path string) {
+	root, err := readDocument(path, "")
+	if err != nil {
+		d.addError(path, err)
+		return
+	}
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		key := root.Content[i]
+		if !dropInKey(key.Value) {
+			d.Items = append(d.Items, Diagnostic{
+				Position: Position{File: path, Line: key.Line, Column: key.Column},
+				Severity: SeverityError,
+				Path:     key.Value,
+				Message:  fmt.Sprintf("key %s is not allowed in drop-in files, only subnets and targets", key.Value),
+			})
+			continue
+		}
+		if key.Value == "subnets" && root.Content[i+1].Kind == yaml.SequenceNode {
+			for j, item := range root.Content[i+1].Content {
+				d.unknownKeys(path, item, reflect.TypeOf(SubnetConfig{}), fmt.Sprintf("subnets[%d]", d.subnetCount+j))
+			}
+		}
+	}
+	if err := d.Config.mergeDropIn(path, root); err != nil {
+		d.addError(path, err)
+	}
+	if items := mappingValue(root, "subnets"); items != nil && items.Kind == yaml.SequenceNode {
+		for _, item := range items.Content {
+			d.index(path, fmt.Sprintf("subnets[%d]", d.subnetCount), item)
+			d.subnetCount++
+		}
+	}
+	if items := mappingValue(root, "targets"); items != nil && items.Kind == yaml.SequenceNode {
+		for _, item := range items.Content {
+			if !containsString(d.targets, item.Value) {
+				d.index(path, fmt.Sprintf("targets[%d]", len(d.targets)), item)
+				d.targets = append(d.targets, item.Value)
+			}
+		}
+	}
+}
+
+func (d *Diagnostics) index(file string, path string, node *yaml.Node) {
+	if path != "" {
+		d.positions[path] = Position{File: file, Line: node.Line, Column: node.Column}
+	}
+	switch node.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key := node.Content[i].Value
+			if path != "" {
+				key = path + "." + key
+			}
+			d.index(file, key, node.Content[i+1])
+		}
+	case yaml.SequenceNode:
+		for i, item := range node.Content {
+			d.index(file, fmt.Sprintf("%s[%d]", path, i), item)
+		}
+	}
+}
+
+func (d *Diagnostics) unknownKeys(file string, node *yaml.Node, t reflect.Type, path string) {
+	severity := SeverityError
+	if d.allowUnknown {
+		severity = SeverityWarning
+	}
+	for _, unknown := range findUnknownKeys(node, t, path) {
+		d.Items = append(d.Items, Diagnostic{
+			Position: Position{File: file, Line: unknown.Key.Line, Column: unknown.Key.Column},
+			Severity: severity,
+			Path:     unknown.Path,
+			Message:  unknown.message(),
+		})
+	}
+}
+
+func (d *Diagnostics) addError(file string, err error) {
+	var typeErr *yaml.TypeError
+	messages := []string{err.Error()}
+	if errors.As(err, &typeErr) {
+		messages = typeErr.Errors
+	}
+	for _, message := range messages {
+		message = strings.TrimPrefix(message, "parse config "+file+": ")
+		message = strings.TrimPrefix(message, "yaml: ")
+		diag := Diagnostic{Position: Position{File: file}, Severity: SeverityError, Message: message}
+		if match := lineNumber.FindStringSubmatchIndex(message); match != nil {
+			diag.Line, _ = strconv.Atoi(message[match[2]:match[3]])
+			if match[0] == 0 {
+				diag.Message = strings.TrimPrefix(message[match[1]:], ": ")
+			}
+		}
+		d.Items = append(d.Items, diag)
+	}
+}
+
+func (d *Diagnostics) Add(severity string, path string, message string) {
+	d.Items = append(d.Items, Diagnostic{Position: d.Lookup(path), Severity: severity, Path: path, Message: message})
+}
+
+func (d *Diagnostics) Lookup(path string) Position {
+	for path != "" {
+		if pos, ok := d.positions[path]; ok {
+			return pos
+		}
+		cut := strings.LastIndexAny(path, ".[")
+		if cut < 0 {
+			break
+		}
+		path = path[:cut]
+	}
+	return Position{File: d.file}
+}
+
+func (d *Diagnostics) Count(severity string) int {
+	count := 0
+	for _, item := range d.Items {
+		if item.Severity == severity {
+			count++
+		}
+	}
+	return count
+}
+
+func (d *Diagnostics) Sort() {
+	sort.SliceStable(d.Items, func(i, j int) bool {
+		a, b := d.Items[i], d.Items[j]
+		if rankA, rankB := d.fileRank(a.File), d.fileRank(b.File); rankA != rankB {
+			return rankA < rankB
+		}
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+}
+
+func (d *Diagnostics) fileRank(file string) int {
+	switch file {
+	case d.file:
+		return 0
+	case "":
+		return 2
+	default:
+		return 1
+	}
+}
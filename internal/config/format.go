@@ -0,0 +1,553 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+	"github.com/pelletier/go-toml/v2/unstable"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	FormatYAML = "yaml"
+	FormatJSON = "json"
+	FormatTOML = "toml"
+)
+
+func DetectFormat(path string, explicit string) (string, error) {
+	if explicit != "" {
+		switch format := strings.ToLower(explicit); format {
+		case FormatYAML, "yml":
+			return FormatYAML, nil
+		case FormatJSON, FormatTOML:
+			return format, nil
+		default:
+			return "", fmt.Errorf("unknown config format %s, expected yaml, json or toml", explicit)
+		}
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return FormatJSON, nil
+	case ".toml":
+		return FormatTOML, nil
+	default:
+		return FormatYAML, nil
+	}
+}
+
+func parseDocument(data []byte, format string) (*yaml.Node, error) {
+	switch format {
+	case FormatJSON:
+		return parseJSON(data)
+	case FormatTOML:
+		var probe map[string]any
+		if err := toml.Unmarshal(data, &probe); err != nil {
+			var decodeErr *toml.DecodeError
+			if errors.As(err, &decodeErr) {
+				row, _ := decodeErr.Position()
+				return nil, fmt.Errorf("line %d: %w", row, err)
+			}
+			return nil, err
+		}
+		return parseTOML(data)
+	default:
+		return parseYAML(data)
+	}
+}
+
+func parseYAML(data []byte) (*yaml.Node, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	if len(doc.Content) == 0 {
+		return newMapping(0, 0), nil
+	}
+	return doc.Content[0], nil
+}
+
+type jsonParser struct {
+	data    []byte
+	decoder *json.Decoder
+	lines   []int
+}
+
+func parseJSON(data []byte) (*yaml.Node, error) {
+	p := &jsonParser{data: data, decoder: json.NewDecoder(bytes.NewReader(data)), lines: []int{0}}
+	p.decoder.UseNumber()
+	for i, b := range data {
+		if b == '\n' {
+			p.lines = append(p.lines, i+1)
+		}
+	}
+	root, err := p.value()
+	if err != nil {
+		return nil, err
+	}
+	if token, line, _, err := p.next(); err != io.EOF {
+		if err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("line %d: unexpected %v after the top-level value", line, token)
+	}
+	return root, nil
+}
+
+func (p *jsonParser) next() (json.Token, int, int, error) {
+	offset := int(p.decoder.InputOffset())
+	for offset < len(p.data) && strings.IndexByte(" \t\r\n,:", p.data[offset]) >= 0 {
+		offset++
+	}
+	line, column := p.position(offset)
+	token, err := p.decoder.Token()
+	if err != nil && err != io.EOF {
+		var syntaxErr *json.SyntaxError
+		if errors.As(err, &syntaxErr) {
+			line, _ = p.position(int(syntaxErr.Offset))
+		}
+		return nil, line, column, fmt.Errorf("line %d: %w", line, err)
+	}
+	return token, line, column, err
+}
+
+func (p *jsonParser) position(offset int) (int, int) {
+	line := sort.Search(len(p.lines), func(i int) bool { return p.lines[i] > offset })
+	return line, offset - p.lines[line-1] + 1
+}
+
+func (p *jsonParser) value() (*yaml.Node, error) {
+	token, line, column, err := p.next()
+	if err == io.EOF {
+		return nil, fmt.Errorf("line %d: unexpected end of JSON input", line)
+	}
+	if err != nil {
+		return nil, err
+	}
+	scalar := func(tag string, value string) *yaml.Node {
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: tag, Value: value, Line: line, Column: column}
+	}
+	switch token := token.(type) {
+	case json.Delim:
+		node := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq", Line: line, Column: column}
+		if token == '{' {
+			node = newMapping(line, column)
+		}
+		for p.decoder.More() {
+			if token == '{' {
+				key, keyLine, keyColumn, err := p.next()
+				if err != nil {
+					return nil, err
+				}
+				node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key.(string), Line: keyLine, Column: keyColumn})
+			}
+			item, err := p.value()
+			if err != nil {
+				return nil, err
+			}
+			node.Content = append(node.Content, item)
+		}
+		if _, _, _, err := p.next(); err != nil {
+			return nil, err
+		}
+		return node, nil
+	case string:
+		return scalar("!!str", token), nil
+	case json.Number:
+		if _, err := token.Int64(); err == nil {
+			return scalar("!!int", token.String()), nil
+		}
+		return scalar("!!float", token.String()), nil
+	case bool:
+		return scalar("!!bool", strconv.FormatBool(token)), nil
+	default:
+		return scalar("!!null", "null"), nil
+	}
+}
+
+func parseTOML(data []byte) (*yaml.Node, error) {
+	root := newMapping(1, 1)
+	current := root
+	parser := unstable.Parser{}
+	parser.Reset(data)
+	for parser.NextExpression() {
+		expr := parser.Expression()
+		switch expr.Kind {
+		case unstable.KeyValue:
+			if err := setTOMLValue(&parser, current, expr); err != nil {
+				return nil, err
+			}
+		case unstable.Table, unstable.ArrayTable:
+			keys := tomlKeys(expr.Key())
+			table := root
+			for i, key := range keys {
+				line, column := tomlPosition(&parser, key)
+				last := i == len(keys)-1
+				if last && expr.Kind == unstable.ArrayTable {
+					items := mappingValue(table, string(key.Data))
+					if items == nil {
+						items = &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq", Line: line, Column: column}
+						appendPair(table, key, items, line, column)
+					}
+					table = newMapping(line, column)
+					items.Content = append(items.Content, table)
+					break
+				}
+				table = tomlTable(table, key, line, column)
+			}
+			current = table
+		}
+	}
+	if err := parser.Error(); err != nil {
+		return nil, err
+	}
+	return root, nil
+}
+
+func setTOMLValue(parser *unstable.Parser, table *yaml.Node, expr *unstable.Node) error {
+	keys := tomlKeys(expr.Key())
+	for _, key := range keys[:len(keys)-1] {
+		line, column := tomlPosition(parser, key)
+		table = tomlTable(table, key, line, column)
+	}
+	key := keys[len(keys)-1]
+	line, column := tomlPosition(parser, key)
+	value, err := tomlValue(parser, expr.Value(), line, column)
+	if err != nil {
+		return err
+	}
+	appendPair(table, key, value, line, column)
+	return nil
+}
+
+func tomlValue(parser *unstable.Parser, node *unstable.Node, line int, column int) (*yaml.Node, error) {
+	if node.Raw.Length > 0 {
+		line, column = tomlPosition(parser, node)
+	}
+	scalar := func(tag string, value string) *yaml.Node {
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: tag, Value: value, Line: line, Column: column}
+	}
+	switch node.Kind {
+	case unstable.String:
+		return scalar("!!str", string(node.Data)), nil
+	case unstable.Bool:
+		return scalar("!!bool", string(node.Data)), nil
+	case unstable.Integer:
+		value, err := strconv.ParseInt(strings.ReplaceAll(string(node.Data), "_", ""), 0, 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid integer %s", line, node.Data)
+		}
+		return scalar("!!int", strconv.FormatInt(value, 10)), nil
+	case unstable.Float:
+		value, err := strconv.ParseFloat(strings.ReplaceAll(string(node.Data), "_", ""), 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid float %s", line, node.Data)
+		}
+		return scalar("!!float", strconv.FormatFloat(value, 'g', -1, 64)), nil
+	case unstable.Array:
+		seq := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq", Line: line, Column: column}
+		children := node.Children()
+		for children.Next() {
+			item, err := tomlValue(parser, children.Node(), line, column)
+			if err != nil {
+				return nil, err
+			}
+			seq.Content = append(seq.Content, item)
+		}
+		return seq, nil
+	case unstable.InlineTable:
+		table := newMapping(line, column)
+		children := node.Children()
+		for children.Next() {
+			if err := setTOMLValue(parser, table, children.Node()); err != nil {
+				return nil, err
+			}
+		}
+		return table, nil
+	default:
+		return scalar("!!str", string(node.Data)), nil
+	}
+}
+
+func tomlKeys(it unstable.Iterator) []*unstable.Node {
+	keys := make([]*unstable.Node, 0)
+	for it.Next() {
+		keys = append(keys, it.Node())
+	}
+	return keys
+}
+
+func tomlPosition(parser *unstable.Parser, node *unstable.Node) (int, int) {
+	start := parser.Shape(node.Raw).Start
+	return start.Line, start.Column
+}
+
+func tomlTable(parent *yaml.Node, key *unstable.Node, line int, column int) *yaml.Node {
+	child := mappingValue(parent, string(key.Data))
+	if child == nil {
+		child = newMapping(line, column)
+		appendPair(parent, key, child, line, column)
+	}
+	if child.Kind == yaml.SequenceNode && len(child.Content) > 0 {
+		return child.Content[len(child.Content)-1]
+	}
+	return child
+}
+
+func appendPair(table *yaml.Node, key *unstable.Node, value *yaml.Node, line int, column int) {
+	table.Content = append(table.Content,
+		&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: string(key.Data), Line: line, Column: column},
+		value,
+	)
+}
+
+func newMapping(line int, column int) *yaml.Node {
+	return &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map", Line: line, Column: column}
+}
+
+func Convert(path string, from string, to string, w io.Writer) error {
+	root, err := readDocument(path, from)
+	if err != nil {
+		return err
+	}
+	format, err := DetectFormat("", to)
+	if err != nil {
+		return err
+	}
+	data, err := encodeDocument(root, format)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+func encodeDocument(root *yaml.Node, format string) ([]byte, error) {
+	var buf bytes.Buffer
+	switch format {
+	case FormatJSON:
+		value, err := nodeValue(root)
+		if err != nil {
+			return nil, err
+		}
+		encoder := json.NewEncoder(&buf)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(value); err != nil {
+			return nil, err
+		}
+	case FormatTOML:
+		if err := writeTOMLTable(&buf, root, nil); err != nil {
+			return nil, err
+		}
+	default:
+		encoder := yaml.NewEncoder(&buf)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(root); err != nil {
+			return nil, err
+		}
+		if err := encoder.Close(); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+type orderedMap struct {
+	keys   []string
+	values []any
+}
+
+func (m orderedMap) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, key := range m.keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		encodedKey, err := json.Marshal(key)
+		if err != nil {
+			return nil, err
+		}
+		encodedValue, err := json.Marshal(m.values[i])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(encodedKey)
+		buf.WriteByte(':')
+		buf.Write(encodedValue)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+func nodeValue(node *yaml.Node) (any, error) {
+	switch node.Kind {
+	case yaml.MappingNode:
+		m := orderedMap{}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			value, err := nodeValue(node.Content[i+1])
+			if err != nil {
+				return nil, err
+			}
+			m.keys = append(m.keys, node.Content[i].Value)
+			m.values = append(m.values, value)
+		}
+		return m, nil
+	case yaml.SequenceNode:
+		items := make([]any, 0, len(node.Content))
+		for _, item := range node.Content {
+			value, err := nodeValue(item)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, value)
+		}
+		return items, nil
+	case yaml.AliasNode:
+		return nodeValue(node.Alias)
+	default:
+		var value any
+		if err := node.Decode(&value); err != nil {
+			return nil, fmt.Errorf("line %d: %w", node.Line, err)
+		}
+		return value, nil
+	}
+}
+
+func writeTOMLTable(w io.Writer, table *yaml.Node, path []string) error {
+	tables := make([]int, 0)
+	arrays := make([]int, 0)
+	for i := 0; i+1 < len(table.Content); i += 2 {
+		key, value := table.Content[i], table.Content[i+1]
+		switch {
+		case value.Kind == yaml.MappingNode:
+			tables = append(tables, i)
+			continue
+		case isTableArray(value):
+			arrays = append(arrays, i)
+			continue
+		case value.ShortTag() == "!!null":
+			continue
+		}
+		encoded, err := tomlInline(value)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "%s = %s\n", tomlKey(key.Value), encoded); err != nil {
+			return err
+		}
+	}
+	for _, i := range tables {
+		childPath := append(append([]string(nil), path...), tomlKey(table.Content[i].Value))
+		if _, err := fmt.Fprintf(w, "\n[%s]\n", strings.Join(childPath, ".")); err != nil {
+			return err
+		}
+		if err := writeTOMLTable(w, table.Content[i+1], childPath); err != nil {
+			return err
+		}
+	}
+	for _, i := range arrays {
+		childPath := append(append([]string(nil), path...), tomlKey(table.Content[i].Value))
+		for _, item := range table.Content[i+1].Content {
+			if _, err := fmt.Fprintf(w, "\n[[%s]]\n", strings.Join(childPath, ".")); err != nil {
+				return err
+			}
+			if err := writeTOMLTable(w, item, childPath); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func isTableArray(node *yaml.Node) bool {
+	if node.Kind != yaml.SequenceNode || len(node.Content) == 0 {
+		return false
+	}
+	for _, item := range node.Content {
+		if item.Kind != yaml.MappingNode {
+			return false
+		}
+	}
+	return true
+}
+
+func tomlInline(node *yaml.Node) (string, error) {
+	switch node.Kind {
+	case yaml.SequenceNode:
+		items := make([]string, 0, len(node.Content))
+		for _, item := range node.Content {
+			encoded, err := tomlInline(item)
+			if err != nil {
+				return "", err
+			}
+			items = append(items, encoded)
+		}
+		return "[" + strings.Join(items, ", ") + "]", nil
+	case yaml.MappingNode:
+		items := make([]string, 0, len(node.Content)/2)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			encoded, err := tomlInline(node.Content[i+1])
+			if err != nil {
+				return "", err
+			}
+			items = append(items, tomlKey(node.Content[i].Value)+" = "+encoded)
+		}
+		return "{ " + strings.Join(items, ", ") + " }", nil
+	case yaml.AliasNode:
+		return tomlInline(node.Alias)
+	}
+	switch node.ShortTag() {
+	case "!!int", "!!float", "!!bool":
+		var value any
+		if err := node.Decode(&value); err != nil {
+			return "", fmt.Errorf("line %d: %w", node.Line, err)
+		}
+		return fmt.Sprint(value), nil
+	case "!!null":
+		return "", fmt.Errorf("line %d: toml has no null value", node.Line)
+	default:
+		return tomlString(node.Value), nil
+	}
+}
+
+func tomlKey(key string) string {
+	if key == "" {
+		return `""`
+	}
+	for _, r := range key {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+			return tomlString(key)
+		}
+	}
+	return key
+}
+
+func tomlString(value string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range value {
+		switch {
+		case r == '"' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r == '\n':
+			b.WriteString(`\n`)
+		case r == '\t':
+			b.WriteString(`\t`)
+		case r < 0x20 || r == 0x7f:
+			fmt.Fprintf(&b, `\u%04X`, r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
@@ -0,0 +1,218 @@
+package config
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+type StringList []string
+
+func (l *StringList) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		*l = StringList{node.Value}
+		return nil
+	}
+	var items []string
+	if err := node.Decode(&items); err != nil {
+		return err
+	}
+	*l = items
+	return nil
+}
+
+type dropIn struct {
+	Subnets []SubnetConfig `yaml:"subnets"`
+	Targets []string       `yaml:"targets"`
+}
+
+func readDocument(path string, format string) (*yaml.Node, error) {
+	format, err := DetectFormat(path, format)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read config: %w", err)
+	}
+	root, err := parseDocument(data, format)
+	if err != nil {
+		return nil, fmt.Errorf("parse config %s: %w", path, err)
+	}
+	if root.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("parse config %s: line %d: expected a mapping", path, root.Line)
+	}
+	return root, nil
+}
+
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+func setSubnetSources(path string, root *yaml.Node, subnets []SubnetConfig) {
+	items := mappingValue(root, "subnets")
+	if items == nil || items.Kind != yaml.SequenceNode {
+		return
+	}
+	for i := range subnets {
+		if i < len(items.Content) {
+			subnets[i].Source = fmt.Sprintf("%s:%d", path, items.Content[i].Line)
+		}
+	}
+}
+
+func (c *Config) includePaths(path string) ([]string, error) {
+	baseDir := filepath.Dir(path)
+	paths := make([]string, 0)
+	for _, pattern := range c.Include {
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(baseDir, pattern)
+		}
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("include %s: %w", pattern, err)
+		}
+		sort.Strings(matches)
+		paths = append(paths, matches...)
+	}
+	return paths, nil
+}
+
+func dropInKey(key string) bool {
+	return key == "subnets" || key == "targets"
+}
+
+func (c *Config) mergeDropIn(path string, root *yaml.Node) error {
+	var extra dropIn
+	decodeErr := root.Decode(&extra)
+	setSubnetSources(path, root, extra.Subnets)
+	c.Subnets = append(c.Subnets, extra.Subnets...)
+	for _, target := range extra.Targets {
+		if !containsString(c.Targets, target) {
+			c.Targets = append(c.Targets, target)
+		}
+	}
+	if decodeErr != nil {
+		return fmt.Errorf("parse config %s: %w", path, decodeErr)
+	}
+	return nil
+}
+
+func containsString(values []string, value string) bool {
+	for _, item := range values {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+func subnetConflicts(subnets []SubnetConfig) []Problem {
+	type parsed struct {
+		index int
+		cfg   SubnetConfig
+		file  string
+		start uint32
+		end   uint32
+		bits  int
+	}
+	nets := make([]parsed, 0, len(subnets))
+	for i, subnet := range subnets {
+		_, ipNet, err := net.ParseCIDR(subnet.CIDR)
+		if err != nil || ipNet.IP.To4() == nil {
+			continue
+		}
+		bits, _ := ipNet.Mask.Size()
+		start := binary.BigEndian.Uint32(ipNet.IP.To4())
+		nets = append(nets, parsed{
+			index: i,
+			cfg:   subnet,
+			file:  sourceFile(subnet.Source),
+			start: start,
+			end:   start | ^binary.BigEndian.Uint32(net.IP(ipNet.Mask).To4()),
+			bits:  bits,
+		})
+	}
+	sort.Slice(nets, func(i, j int) bool {
+		if nets[i].start != nets[j].start {
+			return nets[i].start < nets[j].start
+		}
+		if nets[i].bits != nets[j].bits {
+			return nets[i].bits < nets[j].bits
+		}
+		return nets[i].index < nets[j].index
+	})
+	type conflict struct {
+		rank    int
+		message string
+	}
+	conflicts := make(map[int]conflict)
+	enclosing := make([]parsed, 0, 33)
+	for _, current := range nets {
+		for len(enclosing) > 0 && enclosing[len(enclosing)-1].end < current.start {
+			enclosing = enclosing[:len(enclosing)-1]
+		}
+		for i := len(enclosing) - 1; i >= 0; i-- {
+			outer := enclosing[i]
+			earlier, later := outer, current
+			if earlier.index > later.index {
+				earlier, later = later, earlier
+			}
+			var found conflict
+			switch {
+			case outer.start == current.start && outer.bits == current.bits:
+				found = conflict{rank: 3, message: fmt.Sprintf("duplicate subnet %s: %s duplicates %s", later.cfg.CIDR, describeSubnet(later.cfg), describeSubnet(earlier.cfg))}
+			case outer.file != current.file:
+				found = conflict{rank: 2, message: fmt.Sprintf("overlapping subnets: %s overlaps %s", describeSubnet(later.cfg), describeSubnet(earlier.cfg))}
+			default:
+				found = conflict{rank: 1, message: fmt.Sprintf("overlapping subnets in one file: %s overlaps %s", describeSubnet(later.cfg), describeSubnet(earlier.cfg))}
+			}
+			if found.rank > conflicts[later.index].rank {
+				conflicts[later.index] = found
+			}
+		}
+		enclosing = append(enclosing, current)
+	}
+	indexes := make([]int, 0, len(conflicts))
+	for index := range conflicts {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+	problems := make([]Problem, 0, len(indexes))
+	for _, index := range indexes {
+		problems = append(problems, Problem{
+			Path:    fmt.Sprintf("subnets[%d].cidr", index),
+			Message: conflicts[index].message,
+			Warning: conflicts[index].rank == 1,
+		})
+	}
+	return problems
+}
+
+func sourceFile(source string) string {
+	if i := strings.LastIndex(source, ":"); i >= 0 {
+		return source[:i]
+	}
+	return source
+}
+
+func describeSubnet(subnet SubnetConfig) string {
+	if subnet.Source == "" {
+		return subnet.CIDR
+	}
+	return fmt.Sprintf("%s (%s)", subnet.CIDR, subnet.Source)
+}
@@ -0,0 +1,143 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+
+	"gopkg.in/yaml.v3"
+)
+
+const CurrentVersion = 2
+
+type Deprecation struct {
+	Line    int
+	Column  int
+	Message string
+}
+
+type migration struct {
+	from  int
+	apply func(root *yaml.Node) ([]Deprecation, error)
+}
+
+var migrations = []migration{
+	{from: 1, apply: migrateMountBlock},
+}
+
+func documentVersion(root *yaml.Node) (int, error) {
+	node := mappingValue(root, "version")
+	if node == nil {
+		return 1, nil
+	}
+	version, err := strconv.Atoi(node.Value)
+	if err != nil || node.Kind != yaml.ScalarNode {
+		return 0, fmt.Errorf("line %d: version must be an integer", node.Line)
+	}
+	if version < 1 {
+		return 0, fmt.Errorf("line %d: version must be at least 1", node.Line)
+	}
+	if version > CurrentVersion {
+		return 0, fmt.Errorf("line %d: config version %d is newer than the supported version %d, upgrade subnet-sentinel", node.Line, version, CurrentVersion)
+	}
+	return version, nil
+}
+
+func migrateDocument(root *yaml.Node) (int, []Deprecation, error) {
+	version, err := documentVersion(root)
+	if err != nil {
+		return 0, nil, err
+	}
+	from := version
+	deprecations := make([]Deprecation, 0)
+	for _, m := range migrations {
+		if m.from != version {
+			continue
+		}
+		notes, err := m.apply(root)
+		if err != nil {
+			return 0, nil, err
+		}
+		deprecations = append(deprecations, notes...)
+		version = m.from + 1
+	}
+	setVersion(root, version)
+	return from, deprecations, nil
+}
+
+func setVersion(root *yaml.Node, version int) {
+	value := strconv.Itoa(version)
+	if node := mappingValue(root, "version"); node != nil {
+		node.Value = value
+		node.Tag = "!!int"
+		return
+	}
+	key := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: "version"}
+	if len(root.Content) > 0 {
+		key.HeadComment, root.Content[0].HeadComment = root.Content[0].HeadComment, ""
+	}
+	root.Content = append([]*yaml.Node{key, {Kind: yaml.ScalarNode, Tag: "!!int", Value: value}}, root.Content...)
+}
+
+func removeKey(node *yaml.Node, key string) (*yaml.Node, *yaml.Node) {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			k, v := node.Content[i], node.Content[i+1]
+			node.Content = append(node.Content[:i], node.Content[i+2:]...)
+			return k, v
+		}
+	}
+	return nil, nil
+}
+
+func migrateMountBlock(root *yaml.Node) ([]Deprecation, error) {
+	renames := []struct{ old, new string }{
+		{"autoMountSubnets", "auto"},
+		{"defaultInterface", "defaultInterface"},
+	}
+	deprecations := make([]Deprecation, 0)
+	mount := mappingValue(root, "mount")
+	for _, rename := range renames {
+		key, value := removeKey(root, rename.old)
+		if key == nil {
+			continue
+		}
+		if mount == nil {
+			mount = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map", Line: key.Line, Column: key.Column}
+			root.Content = append(root.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: "mount", Line: key.Line, Column: key.Column}, mount)
+		}
+		if mount.Kind != yaml.MappingNode {
+			return nil, fmt.Errorf("line %d: mount must be a mapping", mount.Line)
+		}
+		if existing := mappingValue(mount, rename.new); existing != nil {
+			return nil, fmt.Errorf("line %d: %s and mount.%s are both set", key.Line, rename.old, rename.new)
+		}
+		key.Value = rename.new
+		mount.Content = append(mount.Content, key, value)
+		deprecations = append(deprecations, Deprecation{
+			Line:    key.Line,
+			Column:  key.Column,
+			Message: fmt.Sprintf("%s is deprecated, use mount.%s", rename.old, rename.new),
+		})
+	}
+	return deprecations, nil
+}
+
+func Migrate(path string, format string) ([]byte, int, error) {
+	format, err := DetectFormat(path, format)
+	if err != nil {
+		return nil, 0, err
+	}
+	root, err := readDocument(path, format)
+	if err != nil {
+		return nil, 0, err
+	}
+	from, _, err := migrateDocument(root)
+	if err != nil {
+		return nil, 0, fmt.Errorf("migrate config %s: %w", path, err)
+	}
+	data, err := encodeDocument(root, format)
+	if err != nil {
+		return nil, 0, err
+	}
+	return data, from, nil
+}
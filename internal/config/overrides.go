@@ -0,0 +1,215 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const EnvPrefix = "SUBNET_SENTINEL_"
+
+type Field struct {
+	Path       string
+	Env        string
+	Flag       string
+	Kind       reflect.Kind
+	Deprecated bool
+}
+
+var renamedFields = []struct{ old, new string }{
+	{"autoMountSubnets", "mount.auto"},
+	{"defaultInterface", "mount.defaultInterface"},
+}
+
+type LoadOptions struct {
+	Environ          []string
+	Overrides        map[string]string
+	AllowUnknownKeys bool
+	Format           string
+	Warn             func(message string)
+}
+
+func ScalarFields() []Field {
+	fields := make([]Field, 0)
+	collectFields(reflect.TypeOf(Config{}), nil, &fields)
+	return fields
+}
+
+func collectFields(t reflect.Type, prefix []string, fields *[]Field) {
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		name := yamlName(sf)
+		if name == "" || (prefix == nil && name == "version") {
+			continue
+		}
+		path := append(append([]string(nil), prefix...), name)
+		ft := sf.Type
+		if ft.Kind() == reflect.Pointer {
+			ft = ft.Elem()
+		}
+		switch ft.Kind() {
+		case reflect.Struct:
+			collectFields(ft, path, fields)
+		case reflect.String, reflect.Bool, reflect.Int, reflect.Int64, reflect.Float64:
+			*fields = append(*fields, namedField(strings.Join(path, "."), path, ft.Kind()))
+		}
+	}
+}
+
+func namedField(path string, name []string, kind reflect.Kind) Field {
+	words := make([]string, 0)
+	for _, part := range name {
+		words = append(words, splitCamel(part)...)
+	}
+	return Field{
+		Path: path,
+		Env:  EnvPrefix + strings.ToUpper(strings.Join(words, "_")),
+		Flag: strings.ToLower(strings.Join(words, "-")),
+		Kind: kind,
+	}
+}
+
+func DeprecatedFields() []Field {
+	current := make(map[string]Field)
+	for _, field := range ScalarFields() {
+		current[field.Path] = field
+	}
+	fields := make([]Field, 0, len(renamedFields))
+	for _, rename := range renamedFields {
+		field := namedField(rename.new, []string{rename.old}, current[rename.new].Kind)
+		field.Deprecated = true
+		fields = append(fields, field)
+	}
+	return fields
+}
+
+func Replacement(field Field) Field {
+	for _, current := range ScalarFields() {
+		if current.Path == field.Path {
+			return current
+		}
+	}
+	return field
+}
+
+func yamlName(sf reflect.StructField) string {
+	tag := sf.Tag.Get("yaml")
+	name, _, _ := strings.Cut(tag, ",")
+	if name == "-" {
+		return ""
+	}
+	if name == "" {
+		return sf.Name
+	}
+	return name
+}
+
+func splitCamel(s string) []string {
+	words := make([]string, 0)
+	start := 0
+	runes := []rune(s)
+	for i := 1; i < len(runes); i++ {
+		if unicode.IsUpper(runes[i]) && !unicode.IsUpper(runes[i-1]) {
+			words = append(words, string(runes[start:i]))
+			start = i
+		}
+	}
+	return append(words, string(runes[start:]))
+}
+
+func EnvOverrides(environ []string) map[string]string {
+	result := make(map[string]string)
+	for _, fields := range [][]Field{DeprecatedFields(), ScalarFields()} {
+		for _, field := range fields {
+			if value, ok := lookupEnv(environ, field.Env); ok {
+				result[field.Path] = value
+			}
+		}
+	}
+	return result
+}
+
+func deprecatedEnv(environ []string) []Field {
+	used := make([]Field, 0)
+	for _, field := range DeprecatedFields() {
+		if _, ok := lookupEnv(environ, field.Env); ok {
+			used = append(used, field)
+		}
+	}
+	return used
+}
+
+func lookupEnv(environ []string, name string) (string, bool) {
+	for _, entry := range environ {
+		if key, value, ok := strings.Cut(entry, "="); ok && key == name {
+			return value, true
+		}
+	}
+	return "", false
+}
+
+func (c *Config) ApplyOverrides(values map[string]string, source string) error {
+	paths := make([]string, 0, len(values))
+	for path := range values {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		if err := setField(reflect.ValueOf(c).Elem(), strings.Split(path, "."), values[path]); err != nil {
+			return fmt.Errorf("%s override %s: %w", source, path, err)
+		}
+	}
+	return nil
+}
+
+func setField(v reflect.Value, path []string, raw string) error {
+	for i := 0; i < v.NumField(); i++ {
+		sf := v.Type().Field(i)
+		if yamlName(sf) != path[0] {
+			continue
+		}
+		fv := v.Field(i)
+		if fv.Kind() == reflect.Pointer {
+			if fv.IsNil() {
+				fv.Set(reflect.New(fv.Type().Elem()))
+			}
+			fv = fv.Elem()
+		}
+		if len(path) > 1 {
+			if fv.Kind() != reflect.Struct {
+				return fmt.Errorf("unknown field")
+			}
+			return setField(fv, path[1:], raw)
+		}
+		raw = strings.TrimSpace(raw)
+		switch fv.Kind() {
+		case reflect.String:
+			fv.SetString(raw)
+		case reflect.Bool:
+			parsed, err := strconv.ParseBool(raw)
+			if err != nil {
+				return fmt.Errorf("invalid boolean %q", raw)
+			}
+			fv.SetBool(parsed)
+		case reflect.Int, reflect.Int64:
+			parsed, err := strconv.ParseInt(raw, 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid integer %q", raw)
+			}
+			fv.SetInt(parsed)
+		case reflect.Float64:
+			parsed, err := strconv.ParseFloat(raw, 64)
+			if err != nil {
+				return fmt.Errorf("invalid number %q", raw)
+			}
+			fv.SetFloat(parsed)
+		default:
+			return fmt.Errorf("field is not a scalar")
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown field")
+}
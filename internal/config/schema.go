@@ -0,0 +1,151 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+)
+
+const ipv4CIDRPattern = `^([0-9]{1,3}\.){3}[0-9]{1,3}/[0-9]{1,2}$`
+
+var schemaConstraints = map[string]orderedMap{
+	"version":                        schemaObject("enum", schemaVersions()),
+	"subnets[].cidr":                 schemaObject("pattern", ipv4CIDRPattern),
+	"subnets[].excludeHosts[]":       schemaObject("format", "ipv4"),
+	"subnets[].sampling.strategy":    schemaObject("enum", []string{SamplingRandom, SamplingStratified, SamplingSweep, SamplingSticky, SamplingLeastRecent}),
+	"subnets[].sampling.blockPrefix": schemaObject("minimum", 0, "maximum", 32),
+	"subnets[].sampling.canaries[]":  schemaObject("format", "ipv4"),
+	"subnets[].sampling.canaryCount": schemaObject("minimum", 0),
+	"subnets[].targets[]":            schemaObject("format", "uri", "pattern", "^https?://"),
+	"subnets[].ipsPerSubnet":         schemaObject("minimum", 0),
+	"subnets[].intervalSeconds":      schemaObject("minimum", 0),
+	"subnets[].timeoutSeconds":       schemaObject("minimum", 0),
+	"subnets[].tags":                 schemaObject("propertyNames", schemaObject("minLength", 1)),
+	"targets[]":                      schemaObject("format", "uri", "pattern", "^https?://"),
+	"ipsPerSubnet":                   schemaObject("minimum", 0),
+	"intervalSeconds":                schemaObject("minimum", 0),
+	"timeoutSeconds":                 schemaObject("minimum", 0),
+	"coverage.windowHours":           schemaObject("minimum", 0),
+	"coverage.retentionHours":        schemaObject("minimum", 0),
+	"localize.blockPrefix":           schemaObject("minimum", 0, "maximum", 32),
+	"localize.samples":               schemaObject("minimum", 0),
+	"quarantine.failureThreshold":    schemaObject("minimum", 0),
+	"quarantine.releaseAfter":        schemaObject("minimum", 0),
+	"quarantine.retestPerRun":        schemaObject("minimum", 0),
+	"thresholds.warningPercent":      schemaObject("minimum", 0, "maximum", 100),
+	"thresholds.criticalPercent":     schemaObject("minimum", 0, "maximum", 100),
+	"logging.file.maxSizeMB":         schemaObject("minimum", 0),
+	"logging.file.maxAgeHours":       schemaObject("minimum", 0),
+	"logging.file.maxBackups":        schemaObject("minimum", 0),
+	"logging.syslog.network":         schemaObject("enum", []string{"udp", "tcp", "unix"}),
+}
+
+var schemaRequired = map[string][]string{
+	"subnets[]": {"cidr"},
+}
+
+func Schema() ([]byte, error) {
+	header := []any{
+		"$schema", "https://json-schema.org/draft/2020-12/schema",
+		"title", "subnet-sentinel configuration",
+	}
+	root := schemaObject(append(header, typeSchema(reflect.TypeOf(Config{}), "").pairs()...)...)
+	data, err := json.Marshal(root)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, data, "", "  "); err != nil {
+		return nil, err
+	}
+	buf.WriteByte('\n')
+	return buf.Bytes(), nil
+}
+
+func typeSchema(t reflect.Type, path string) orderedMap {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	var schema orderedMap
+	switch {
+	case t == reflect.TypeOf(StringList{}):
+		item := schemaObject("type", "string")
+		schema = schemaObject("oneOf", []any{item, schemaObject("type", "array", "items", item)})
+	case t.Kind() == reflect.Struct:
+		properties := orderedMap{}
+		for i := 0; i < t.NumField(); i++ {
+			name := yamlName(t.Field(i))
+			if name == "" {
+				continue
+			}
+			childPath := name
+			if path != "" {
+				childPath = path + "." + name
+			}
+			properties.keys = append(properties.keys, name)
+			properties.values = append(properties.values, typeSchema(t.Field(i).Type, childPath))
+		}
+		if path == "" {
+			for _, rename := range renamedFields {
+				renamed := typeSchema(pathType(t, rename.new), rename.new)
+				properties.keys = append(properties.keys, rename.old)
+				properties.values = append(properties.values, schemaObject(append(renamed.pairs(), "deprecated", true, "description", "use "+rename.new)...))
+			}
+		}
+		schema = schemaObject("type", "object", "properties", properties, "additionalProperties", false)
+		if required, ok := schemaRequired[path]; ok {
+			schema = schemaObject(append(schema.pairs(), "required", required)...)
+		}
+	case t.Kind() == reflect.Slice:
+		schema = schemaObject("type", "array", "items", typeSchema(t.Elem(), path+"[]"))
+	case t.Kind() == reflect.Map:
+		schema = schemaObject("type", "object", "additionalProperties", typeSchema(t.Elem(), path+"{}"))
+	case t.Kind() == reflect.String:
+		schema = schemaObject("type", "string")
+	case t.Kind() == reflect.Bool:
+		schema = schemaObject("type", "boolean")
+	case t.Kind() == reflect.Int || t.Kind() == reflect.Int64:
+		schema = schemaObject("type", "integer")
+	case t.Kind() == reflect.Float64:
+		schema = schemaObject("type", "number")
+	default:
+		schema = orderedMap{}
+	}
+	if extra, ok := schemaConstraints[path]; ok {
+		schema = schemaObject(append(schema.pairs(), extra.pairs()...)...)
+	}
+	return schema
+}
+
+func schemaVersions() []int {
+	versions := make([]int, 0, CurrentVersion)
+	for version := 1; version <= CurrentVersion; version++ {
+		versions = append(versions, version)
+	}
+	return versions
+}
+
+func pathType(t reflect.Type, path string) reflect.Type {
+	for _, name := range strings.Split(path, ".") {
+		t, _ = structField(t, name)
+	}
+	return t
+}
+
+func schemaObject(pairs ...any) orderedMap {
+	m := orderedMap{}
+	for i := 0; i+1 < len(pairs); i += 2 {
+		m.keys = append(m.keys, pairs[i].(string))
+		m.values = append(m.values, pairs[i+1])
+	}
+	return m
+}
+
+func (m orderedMap) pairs() []any {
+	pairs := make([]any, 0, len(m.keys)*2)
+	for i, key := range m.keys {
+		pairs = append(pairs, key, m.values[i])
+	}
+	return pairs
+}
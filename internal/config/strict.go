@@ -0,0 +1,101 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+type unknownKey struct {
+	Key        *yaml.Node
+	Path       string
+	Suggestion string
+}
+
+func (u unknownKey) message() string {
+	if u.Suggestion == "" {
+		return fmt.Sprintf("unknown key %s", u.Path)
+	}
+	return fmt.Sprintf("unknown key %s, did you mean %s?", u.Path, u.Suggestion)
+}
+
+func findUnknownKeys(node *yaml.Node, t reflect.Type, path string) []unknownKey {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	unknown := make([]unknownKey, 0)
+	switch {
+	case node.Kind == yaml.SequenceNode && t.Kind() == reflect.Slice:
+		for i, item := range node.Content {
+			unknown = append(unknown, findUnknownKeys(item, t.Elem(), fmt.Sprintf("%s[%d]", path, i))...)
+		}
+	case node.Kind == yaml.MappingNode && t.Kind() == reflect.Struct:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key := node.Content[i]
+			keyPath := key.Value
+			if path != "" {
+				keyPath = path + "." + key.Value
+			}
+			fieldType, ok := structField(t, key.Value)
+			if !ok {
+				unknown = append(unknown, unknownKey{Key: key, Path: keyPath, Suggestion: closestField(t, key.Value)})
+				continue
+			}
+			unknown = append(unknown, findUnknownKeys(node.Content[i+1], fieldType, keyPath)...)
+		}
+	}
+	return unknown
+}
+
+func structField(t reflect.Type, name string) (reflect.Type, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		if yamlName(t.Field(i)) == name {
+			return t.Field(i).Type, true
+		}
+	}
+	return nil, false
+}
+
+func closestField(t reflect.Type, name string) string {
+	best, bestDistance := "", -1
+	for i := 0; i < t.NumField(); i++ {
+		candidate := yamlName(t.Field(i))
+		if candidate == "" {
+			continue
+		}
+		distance := editDistance(strings.ToLower(name), strings.ToLower(candidate))
+		if bestDistance < 0 || distance < bestDistance {
+			best, bestDistance = candidate, distance
+		}
+	}
+	limit := len(name) / 3
+	if limit < 2 {
+		limit = 2
+	}
+	if bestDistance < 0 || bestDistance > limit {
+		return ""
+	}
+	return best
+}
+
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
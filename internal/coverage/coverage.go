@@ -0,0 +1,185 @@
+package coverage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	mathrand "math/rand"
+	"net"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/thealonlevi/subnet-sentinel/internal/statefile"
+	"github.com/thealonlevi/subnet-sentinel/internal/subnets"
+)
+
+type Tracker struct {
+	Retention time.Duration
+
+	mu      sync.Mutex
+	path    string
+	subnets map[string]map[string]time.Time
+}
+
+type state struct {
+	Subnets map[string]map[string]time.Time `json:"subnets"`
+}
+
+type SubnetCoverage struct {
+	Subnet  string
+	Hosts   int
+	Covered int
+	Percent float64
+}
+
+func New() *Tracker {
+	return &Tracker{subnets: make(map[string]map[string]time.Time)}
+}
+
+func Load(path string) (*Tracker, error) {
+	tracker := New()
+	tracker.path = path
+	if path == "" {
+		return tracker, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return tracker, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read coverage: %w", err)
+	}
+	var st state
+	if err := json.Unmarshal(data, &st); err != nil {
+		return nil, fmt.Errorf("parse coverage %s: %w", path, err)
+	}
+	for subnet, hosts := range st.Subnets {
+		if hosts != nil {
+			tracker.subnets[subnet] = hosts
+		}
+	}
+	return tracker, nil
+}
+
+func (t *Tracker) Save() error {
+	if t.path == "" {
+		return nil
+	}
+	t.mu.Lock()
+	if t.Retention > 0 {
+		t.prune(time.Now().Add(-t.Retention))
+	}
+	data, err := json.Marshal(state{Subnets: t.subnets})
+	t.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("encode coverage: %w", err)
+	}
+	return statefile.WriteAtomic(t.path, data)
+}
+
+func (t *Tracker) prune(before time.Time) {
+	for subnet, hosts := range t.subnets {
+		for host, at := range hosts {
+			if at.Before(before) {
+				delete(hosts, host)
+			}
+		}
+		if len(hosts) == 0 {
+			delete(t.subnets, subnet)
+		}
+	}
+}
+
+func (t *Tracker) Record(subnet string, ip net.IP, at time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	hosts, ok := t.subnets[subnet]
+	if !ok {
+		hosts = make(map[string]time.Time)
+		t.subnets[subnet] = hosts
+	}
+	key := ip.String()
+	if at.After(hosts[key]) {
+		hosts[key] = at
+	}
+}
+
+func (t *Tracker) LastProbed(subnet string, ip net.IP) (time.Time, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	at, ok := t.subnets[subnet][ip.String()]
+	return at, ok
+}
+
+func (t *Tracker) Coverage(subnet string, pool *subnets.HostPool, since time.Time) SubnetCoverage {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	result := SubnetCoverage{Subnet: subnet, Hosts: pool.Size()}
+	for host, at := range t.subnets[subnet] {
+		if at.Before(since) {
+			continue
+		}
+		if pool.Contains(net.ParseIP(host)) {
+			result.Covered++
+		}
+	}
+	if result.Hosts > 0 {
+		result.Percent = float64(result.Covered) * 100 / float64(result.Hosts)
+	}
+	return result
+}
+
+type Sampler struct {
+	Tracker *Tracker
+	Subnet  string
+}
+
+func (s Sampler) Select(r *mathrand.Rand, pool *subnets.HostPool, count int) ([]net.IP, error) {
+	if count <= 0 {
+		return nil, fmt.Errorf("count must be positive")
+	}
+	if count > pool.Size() {
+		return nil, fmt.Errorf("subnet %s does not have enough available hosts", pool.Name())
+	}
+	type probed struct {
+		ip net.IP
+		at time.Time
+	}
+	s.Tracker.mu.Lock()
+	tested := make([]probed, 0, len(s.Tracker.subnets[s.Subnet]))
+	for host, at := range s.Tracker.subnets[s.Subnet] {
+		ip := net.ParseIP(host).To4()
+		if ip != nil && pool.Contains(ip) {
+			tested = append(tested, probed{ip: ip, at: at})
+		}
+	}
+	s.Tracker.mu.Unlock()
+	testedIPs := make([]net.IP, 0, len(tested))
+	for _, p := range tested {
+		testedIPs = append(testedIPs, p.ip)
+	}
+	untested := pool.Without(testedIPs)
+	if untested.Size() >= count {
+		return untested.Sample(r, count)
+	}
+	results := make([]net.IP, 0, count)
+	if untested.Size() > 0 {
+		hosts, err := untested.Sample(r, untested.Size())
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, hosts...)
+	}
+	r.Shuffle(len(tested), func(i, j int) {
+		tested[i], tested[j] = tested[j], tested[i]
+	})
+	sort.SliceStable(tested, func(i, j int) bool {
+		return tested[i].at.Before(tested[j].at)
+	})
+	for _, p := range tested[:count-len(results)] {
+		results = append(results, p.ip)
+	}
+	return results, nil
+}
@@ -0,0 +1,116 @@
+package coverage
+
+import (
+	mathrand "math/rand"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/thealonlevi/subnet-sentinel/internal/config"
+	"github.com/thealonlevi/subnet-sentinel/internal/subnets"
+)
+
+func testSubnet(t *testing.T, cidr string) subnets.Subnet {
+	t.Helper()
+	subs, err := subnets.FromConfigs([]config.SubnetConfig{{CIDR: cidr}})
+	if err != nil {
+		t.Fatalf("subnet parse: %v", err)
+	}
+	return subs[0]
+}
+
+func TestSamplerPrefersLeastRecentlyTested(t *testing.T) {
+	subnet := testSubnet(t, "10.4.0.0/27")
+	tracker := New()
+	sampler := Sampler{Tracker: tracker, Subnet: subnet.CIDR}
+	r := mathrand.New(mathrand.NewSource(1))
+	now := time.Now()
+	seen := make(map[string]int)
+	for cycle := 0; cycle < 10; cycle++ {
+		hosts, err := sampler.Select(r, subnet.Pool, 3)
+		if err != nil {
+			t.Fatalf("select: %v", err)
+		}
+		for _, host := range hosts {
+			seen[host.String()]++
+			tracker.Record(subnet.CIDR, host, now.Add(time.Duration(cycle)*time.Minute))
+		}
+	}
+	if len(seen) != 30 {
+		t.Fatalf("expected 30 distinct hosts after 10 cycles, got %d", len(seen))
+	}
+	hosts, err := sampler.Select(r, subnet.Pool, 3)
+	if err != nil {
+		t.Fatalf("select: %v", err)
+	}
+	for _, host := range hosts {
+		at, ok := tracker.LastProbed(subnet.CIDR, host)
+		if !ok || !at.Equal(now) {
+			t.Fatalf("expected oldest host to be re-tested, got %s probed at %s", host, at)
+		}
+	}
+}
+
+func TestTrackerCoverageRoundTrip(t *testing.T) {
+	subnet := testSubnet(t, "10.5.0.0/29")
+	path := filepath.Join(t.TempDir(), "coverage.json")
+	tracker, err := Load(path)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	now := time.Now()
+	tracker.Record(subnet.CIDR, net.ParseIP("10.5.0.1"), now.Add(-48*time.Hour))
+	tracker.Record(subnet.CIDR, net.ParseIP("10.5.0.2"), now.Add(-time.Hour))
+	tracker.Record(subnet.CIDR, net.ParseIP("10.5.0.3"), now)
+	if err := tracker.Save(); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	cov := loaded.Coverage(subnet.CIDR, subnet.Pool, now.Add(-24*time.Hour))
+	if cov.Hosts != 6 || cov.Covered != 2 {
+		t.Fatalf("expected 2/6 hosts covered, got %d/%d", cov.Covered, cov.Hosts)
+	}
+	if cov.Percent < 33.3 || cov.Percent > 33.4 {
+		t.Fatalf("expected 33.3 percent, got %.2f", cov.Percent)
+	}
+}
+
+func TestTrackerSavePrunesEntriesOutsideRetention(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "coverage.json")
+	tracker, err := Load(path)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	now := time.Now()
+	tracker.Record("10.6.0.0/29", net.ParseIP("10.6.0.1"), now.Add(-48*time.Hour))
+	tracker.Record("10.6.0.0/29", net.ParseIP("10.6.0.2"), now.Add(-time.Hour))
+	tracker.Record("10.7.0.0/29", net.ParseIP("10.7.0.1"), now.Add(-72*time.Hour))
+	if err := tracker.Save(); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	loaded, err := Load(path)
+	if err != nil || len(loaded.subnets) != 2 {
+		t.Fatalf("expected every entry to be kept without a retention, got %v, %v", loaded.subnets, err)
+	}
+	tracker.Retention = 24 * time.Hour
+	if err := tracker.Save(); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	loaded, err = Load(path)
+	if err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	if _, ok := loaded.LastProbed("10.6.0.0/29", net.ParseIP("10.6.0.1")); ok {
+		t.Fatalf("expected stale entry to be pruned")
+	}
+	if _, ok := loaded.LastProbed("10.6.0.0/29", net.ParseIP("10.6.0.2")); !ok {
+		t.Fatalf("expected recent entry to be kept")
+	}
+	if len(loaded.subnets) != 1 {
+		t.Fatalf("expected subnet without recent entries to be dropped, got %v", loaded.subnets)
+	}
+}
@@ -0,0 +1,84 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const DefaultJournalSocket = "/run/systemd/journal/socket"
+
+type journalSink struct {
+	mu   sync.Mutex
+	conn net.Conn
+	tag  string
+}
+
+func newJournalSink(socket, tag string) (*journalSink, error) {
+	if socket == "" {
+		socket = DefaultJournalSocket
+	}
+	conn, err := net.Dial("unixgram", socket)
+	if err != nil {
+		return nil, fmt.Errorf("connect to journald %s: %w", socket, err)
+	}
+	return &journalSink{conn: conn, tag: tag}, nil
+}
+
+func (j *journalSink) emit(r slog.Record, attrs []slog.Attr) error {
+	var buf bytes.Buffer
+	appendJournalField(&buf, "MESSAGE", r.Message)
+	appendJournalField(&buf, "PRIORITY", strconv.Itoa(severity(r.Level)))
+	appendJournalField(&buf, "SYSLOG_IDENTIFIER", j.tag)
+	for _, a := range attrs {
+		appendJournalField(&buf, journalFieldName(a.Key), a.Value.String())
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	_, err := j.conn.Write(buf.Bytes())
+	return err
+}
+
+func (j *journalSink) Close() error {
+	return j.conn.Close()
+}
+
+func appendJournalField(buf *bytes.Buffer, name, value string) {
+	buf.WriteString(name)
+	if !strings.Contains(value, "\n") {
+		buf.WriteByte('=')
+		buf.WriteString(value)
+		buf.WriteByte('\n')
+		return
+	}
+	buf.WriteByte('\n')
+	var size [8]byte
+	binary.LittleEndian.PutUint64(size[:], uint64(len(value)))
+	buf.Write(size[:])
+	buf.WriteString(value)
+	buf.WriteByte('\n')
+}
+
+func journalFieldName(key string) string {
+	var b strings.Builder
+	for _, r := range strings.ToUpper(key) {
+		if (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+		} else {
+			b.WriteByte('_')
+		}
+	}
+	name := strings.TrimLeft(b.String(), "_")
+	if name == "" || (name[0] >= '0' && name[0] <= '9') {
+		name = "FIELD_" + name
+	}
+	if len(name) > 64 {
+		name = name[:64]
+	}
+	return name
+}
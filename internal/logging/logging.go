@@ -1,66 +1,146 @@
 package logging
 
 import (
+	"errors"
 	"fmt"
-	"log"
+	"io"
+	"log/slog"
 	"os"
 	"strings"
 )
 
-type Level int
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
 
 const (
-	LevelDebug Level = iota
-	LevelInfo
-	LevelError
+	OutputStdout   = "stdout"
+	OutputFile     = "file"
+	OutputSyslog   = "syslog"
+	OutputJournald = "journald"
 )
 
+type Options struct {
+	Level         string
+	Format        string
+	Writer        io.Writer
+	Outputs       []string
+	Tag           string
+	File          FileOptions
+	Syslog        SyslogOptions
+	JournalSocket string
+}
+
 type Logger struct {
-	level Level
-	base  *log.Logger
+	*slog.Logger
+	closers []io.Closer
 }
 
 func New(level string) (Logger, error) {
-	lvl, err := ParseLevel(level)
+	return NewWithOptions(Options{Level: level})
+}
+
+func NewWithOptions(opts Options) (Logger, error) {
+	lvl, err := ParseLevel(opts.Level)
 	if err != nil {
 		return Logger{}, err
 	}
-	return Logger{
-		level: lvl,
-		base:  log.New(os.Stdout, "", log.LstdFlags),
-	}, nil
+	format := strings.ToLower(strings.TrimSpace(opts.Format))
+	switch format {
+	case "", FormatText, FormatJSON:
+	default:
+		return Logger{}, fmt.Errorf("invalid log format %s", opts.Format)
+	}
+	tag := opts.Tag
+	if tag == "" {
+		tag = "subnet-sentinel"
+	}
+	outputs := opts.Outputs
+	if len(outputs) == 0 {
+		outputs = []string{OutputStdout}
+	}
+	logger := Logger{}
+	handlers := make(multiHandler, 0, len(outputs))
+	for _, output := range outputs {
+		handler, closer, err := newOutput(output, format, lvl, tag, opts)
+		if err != nil {
+			logger.Close()
+			return Logger{}, err
+		}
+		handlers = append(handlers, handler)
+		if closer != nil {
+			logger.closers = append(logger.closers, closer)
+		}
+	}
+	if len(handlers) == 1 {
+		logger.Logger = slog.New(handlers[0])
+	} else {
+		logger.Logger = slog.New(handlers)
+	}
+	return logger, nil
 }
 
-func ParseLevel(level string) (Level, error) {
-	switch strings.ToLower(strings.TrimSpace(level)) {
-	case "debug":
-		return LevelDebug, nil
-	case "info":
-		return LevelInfo, nil
-	case "error":
-		return LevelError, nil
+func newOutput(output, format string, lvl slog.Level, tag string, opts Options) (slog.Handler, io.Closer, error) {
+	switch strings.ToLower(strings.TrimSpace(output)) {
+	case OutputStdout:
+		writer := opts.Writer
+		if writer == nil {
+			writer = os.Stdout
+		}
+		return formatHandler(writer, format, lvl), nil, nil
+	case OutputFile:
+		file, err := openRotatingFile(opts.File)
+		if err != nil {
+			return nil, nil, err
+		}
+		return formatHandler(file, format, lvl), file, nil
+	case OutputSyslog:
+		sink, err := newSyslogSink(opts.Syslog, tag)
+		if err != nil {
+			return nil, nil, err
+		}
+		return newAttrHandler(lvl, sink), sink, nil
+	case OutputJournald:
+		sink, err := newJournalSink(opts.JournalSocket, tag)
+		if err != nil {
+			return nil, nil, err
+		}
+		return newAttrHandler(lvl, sink), sink, nil
 	default:
-		return LevelInfo, fmt.Errorf("invalid log level %s", level)
+		return nil, nil, fmt.Errorf("invalid log output %s", output)
 	}
 }
 
-func (l Logger) Debug(message string, args ...interface{}) {
-	if l.level > LevelDebug {
-		return
+func formatHandler(writer io.Writer, format string, lvl slog.Level) slog.Handler {
+	handlerOpts := &slog.HandlerOptions{Level: lvl}
+	if format == FormatJSON {
+		return slog.NewJSONHandler(writer, handlerOpts)
 	}
-	l.base.Printf("DEBUG "+message, args...)
+	return slog.NewTextHandler(writer, handlerOpts)
 }
 
-func (l Logger) Info(message string, args ...interface{}) {
-	if l.level > LevelInfo {
-		return
+func (l Logger) Close() error {
+	var errs []error
+	for _, closer := range l.closers {
+		if err := closer.Close(); err != nil {
+			errs = append(errs, err)
+		}
 	}
-	l.base.Printf("INFO "+message, args...)
+	return errors.Join(errs...)
 }
 
-func (l Logger) Error(message string, args ...interface{}) {
-	if l.level > LevelError {
-		return
+func ParseLevel(level string) (slog.Level, error) {
+	switch strings.ToLower(strings.TrimSpace(level)) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "", "info":
+		return slog.LevelInfo, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	default:
+		return slog.LevelInfo, fmt.Errorf("invalid log level %s", level)
 	}
-	l.base.Printf("ERROR "+message, args...)
 }
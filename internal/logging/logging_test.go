@@ -0,0 +1,330 @@
+package logging
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestJSONFormatWritesAttributes(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := NewWithOptions(Options{Level: "warn", Format: FormatJSON, Writer: &buf})
+	if err != nil {
+		t.Fatalf("new logger: %v", err)
+	}
+	logger.Info("hidden", "subnet", "10.0.0.0/24")
+	logger.Warn("quarantined", "subnet", "10.0.0.0/24", "ip", "10.0.0.7", "status", 502)
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("expected one line above warn level, got %q", buf.String())
+	}
+	var entry map[string]any
+	if err := json.Unmarshal([]byte(lines[0]), &entry); err != nil {
+		t.Fatalf("decode %q: %v", lines[0], err)
+	}
+	if entry["level"] != "WARN" || entry["msg"] != "quarantined" || entry["ip"] != "10.0.0.7" || entry["status"] != float64(502) {
+		t.Fatalf("unexpected entry %v", entry)
+	}
+}
+
+func TestNewRejectsUnknownSettings(t *testing.T) {
+	if _, err := NewWithOptions(Options{Level: "loud"}); err == nil {
+		t.Fatalf("expected invalid level error")
+	}
+	if _, err := NewWithOptions(Options{Format: "xml"}); err == nil {
+		t.Fatalf("expected invalid format error")
+	}
+}
+
+var rfc5424 = regexp.MustCompile(`^<(\d+)>1 \S+ \S+ (\S+) \d+ - (\[meta@32473.*\]|-) (.*)$`)
+
+func TestSyslogUDPWritesRFC5424(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer conn.Close()
+	logger, err := NewWithOptions(Options{
+		Outputs: []string{OutputSyslog},
+		Tag:     "sentinel-test",
+		Syslog:  SyslogOptions{Network: "udp", Address: conn.LocalAddr().String(), Facility: "local3"},
+	})
+	if err != nil {
+		t.Fatalf("new logger: %v", err)
+	}
+	defer logger.Close()
+	logger.With("subnet", "10.0.0.0/24").Warn("request failed", "ip", "10.0.0.7", "error", `bad "gateway"]`)
+	buf := make([]byte, 4096)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	m := rfc5424.FindStringSubmatch(string(buf[:n]))
+	if m == nil {
+		t.Fatalf("message %q is not RFC5424", buf[:n])
+	}
+	if m[1] != strconv.Itoa(19*8+4) || m[2] != "sentinel-test" || m[4] != "request failed" {
+		t.Fatalf("unexpected header fields %q", m[1:])
+	}
+	want := `[meta@32473 subnet="10.0.0.0/24" ip="10.0.0.7" error="bad \"gateway\"\]"]`
+	if m[3] != want {
+		t.Fatalf("structured data %s, want %s", m[3], want)
+	}
+}
+
+func TestSyslogTCPUsesOctetCounting(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer ln.Close()
+	received := make(chan []string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		reader := bufio.NewReader(conn)
+		var messages []string
+		for len(messages) < 2 {
+			size, err := reader.ReadString(' ')
+			if err != nil {
+				break
+			}
+			n, _ := strconv.Atoi(strings.TrimSpace(size))
+			msg := make([]byte, n)
+			if _, err := io.ReadFull(reader, msg); err != nil {
+				break
+			}
+			messages = append(messages, string(msg))
+		}
+		received <- messages
+	}()
+	logger, err := NewWithOptions(Options{
+		Level:   "debug",
+		Outputs: []string{OutputSyslog},
+		Syslog:  SyslogOptions{Network: "tcp", Address: ln.Addr().String()},
+	})
+	if err != nil {
+		t.Fatalf("new logger: %v", err)
+	}
+	defer logger.Close()
+	logger.Debug("first")
+	logger.Error("second", "status", 502)
+	select {
+	case messages := <-received:
+		if len(messages) != 2 {
+			t.Fatalf("expected two framed messages, got %q", messages)
+		}
+		first := rfc5424.FindStringSubmatch(messages[0])
+		second := rfc5424.FindStringSubmatch(messages[1])
+		if first == nil || second == nil {
+			t.Fatalf("messages are not RFC5424: %q", messages)
+		}
+		if first[1] != strconv.Itoa(3*8+7) || first[3] != "-" || second[1] != strconv.Itoa(3*8+3) || second[3] != `[meta@32473 status="502"]` {
+			t.Fatalf("unexpected messages %q", messages)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for syslog messages")
+	}
+}
+
+func TestJournaldWritesNativeFields(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "journal.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer conn.Close()
+	logger, err := NewWithOptions(Options{Outputs: []string{OutputJournald}, JournalSocket: socket})
+	if err != nil {
+		t.Fatalf("new logger: %v", err)
+	}
+	defer logger.Close()
+	logger.WithGroup("req").Info("probe", "duration_ms", 12, "body", "line one\nline two")
+	buf := make([]byte, 4096)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	fields := parseJournal(t, buf[:n])
+	want := map[string]string{
+		"MESSAGE":           "probe",
+		"PRIORITY":          "6",
+		"SYSLOG_IDENTIFIER": "subnet-sentinel",
+		"REQ_DURATION_MS":   "12",
+		"REQ_BODY":          "line one\nline two",
+	}
+	for key, value := range want {
+		if fields[key] != value {
+			t.Fatalf("field %s = %q, want %q (all fields %q)", key, fields[key], value, fields)
+		}
+	}
+}
+
+func parseJournal(t *testing.T, data []byte) map[string]string {
+	t.Helper()
+	fields := map[string]string{}
+	for len(data) > 0 {
+		end := bytes.IndexAny(data, "=\n")
+		if end < 0 {
+			t.Fatalf("truncated journal entry %q", data)
+		}
+		name := string(data[:end])
+		if data[end] == '=' {
+			data = data[end+1:]
+			line := bytes.IndexByte(data, '\n')
+			fields[name] = string(data[:line])
+			data = data[line+1:]
+			continue
+		}
+		data = data[end+1:]
+		size := binary.LittleEndian.Uint64(data[:8])
+		fields[name] = string(data[8 : 8+size])
+		data = data[8+size+1:]
+	}
+	return fields
+}
+
+func TestFileRotatesCompressesAndPrunes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sentinel.log")
+	file, err := openRotatingFile(FileOptions{Path: path, MaxSize: 64, MaxBackups: 2, Compress: true})
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	clock := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	file.now = func() time.Time {
+		clock = clock.Add(time.Second)
+		return clock
+	}
+	line := []byte(strings.Repeat("x", 39) + "\n")
+	for i := 0; i < 5; i++ {
+		if _, err := file.Write(line); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+	if err := file.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	backups, err := filepath.Glob(filepath.Join(filepath.Dir(path), "sentinel-*.log.gz"))
+	if err != nil {
+		t.Fatalf("glob: %v", err)
+	}
+	if len(backups) != 2 {
+		t.Fatalf("expected two compressed backups after pruning, got %v", backups)
+	}
+	f, err := os.Open(backups[1])
+	if err != nil {
+		t.Fatalf("open backup: %v", err)
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatalf("gzip: %v", err)
+	}
+	data, err := io.ReadAll(zr)
+	if err != nil || !bytes.Equal(data, line) {
+		t.Fatalf("backup content %q, %v", data, err)
+	}
+	current, err := os.ReadFile(path)
+	if err != nil || !bytes.Equal(current, line) {
+		t.Fatalf("current log %q, %v", current, err)
+	}
+}
+
+func TestFilePruneKeepsSimilarlyNamedFiles(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "sentinel.log")
+	unrelated := []string{"sentinel-1.log", "sentinel-debug.log", "sentinel-debug.log.gz", "sentinel-20260102T030405.log"}
+	for _, name := range unrelated {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0o644); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+	file, err := openRotatingFile(FileOptions{Path: path, MaxSize: 8, MaxBackups: 1})
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	clock := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	file.now = func() time.Time {
+		clock = clock.Add(time.Second)
+		return clock
+	}
+	for i := 0; i < 4; i++ {
+		file.Write([]byte("line\n"))
+	}
+	if err := file.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	for _, name := range unrelated {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Fatalf("expected %s to survive pruning: %v", name, err)
+		}
+	}
+	backups, _ := filepath.Glob(filepath.Join(dir, "sentinel-2026*.000.log"))
+	if len(backups) != 1 {
+		t.Fatalf("expected one backup after pruning, got %v", backups)
+	}
+}
+
+func TestFileRotatesByAge(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sentinel.log")
+	file, err := openRotatingFile(FileOptions{Path: path, MaxAge: time.Hour})
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer file.Close()
+	clock := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	file.now = func() time.Time { return clock }
+	file.opened = clock
+	file.Write([]byte("old\n"))
+	clock = clock.Add(time.Hour)
+	file.Write([]byte("new\n"))
+	if _, err := os.Stat(filepath.Join(filepath.Dir(path), "sentinel-20260102T040405.000.log")); err != nil {
+		t.Fatalf("expected an uncompressed backup: %v", err)
+	}
+	current, _ := os.ReadFile(path)
+	if string(current) != "new\n" {
+		t.Fatalf("current log %q", current)
+	}
+}
+
+func TestFileKeepsWritingWhenRotationFails(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sentinel.log")
+	file, err := openRotatingFile(FileOptions{Path: path, MaxSize: 8})
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer file.Close()
+	clock := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	file.now = func() time.Time { return clock }
+	if err := os.Mkdir(filepath.Join(filepath.Dir(path), "sentinel-20260102T030405.000.log"), 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	file.Write([]byte("first\n"))
+	if n, err := file.Write([]byte("second\n")); n != 7 || err == nil || !strings.Contains(err.Error(), "rotate log file") {
+		t.Fatalf("expected the line written and the rename error reported, got %d, %v", n, err)
+	}
+	clock = clock.Add(time.Second)
+	if _, err := file.Write([]byte("third\n")); err != nil {
+		t.Fatalf("write after failed rotation: %v", err)
+	}
+	current, _ := os.ReadFile(path)
+	if string(current) != "third\n" {
+		t.Fatalf("current log %q", current)
+	}
+}
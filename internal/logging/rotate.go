@@ -0,0 +1,225 @@
+package logging
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const backupLayout = "20060102T150405.000"
+
+type FileOptions struct {
+	Path       string
+	MaxSize    int64
+	MaxAge     time.Duration
+	MaxBackups int
+	Compress   bool
+}
+
+type rotatingFile struct {
+	mu         sync.Mutex
+	opts       FileOptions
+	file       *os.File
+	size       int64
+	opened     time.Time
+	now        func() time.Time
+	archived   chan struct{}
+	pending    sync.WaitGroup
+	archiveErr error
+}
+
+func openRotatingFile(opts FileOptions) (*rotatingFile, error) {
+	if opts.Path == "" {
+		return nil, fmt.Errorf("log file path is required")
+	}
+	f := &rotatingFile{opts: opts, now: time.Now}
+	if err := os.MkdirAll(filepath.Dir(opts.Path), 0o755); err != nil {
+		return nil, fmt.Errorf("create log directory: %w", err)
+	}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *rotatingFile) open() error {
+	file, err := os.OpenFile(f.opts.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("open log file: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("stat log file: %w", err)
+	}
+	f.file = file
+	f.size = info.Size()
+	f.opened = f.now()
+	return nil
+}
+
+func (f *rotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file == nil {
+		return 0, os.ErrClosed
+	}
+	var rotateErr error
+	if f.shouldRotate(len(p)) {
+		rotateErr = f.rotate()
+		if f.file == nil {
+			return 0, rotateErr
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	if err == nil {
+		err = rotateErr
+	}
+	return n, err
+}
+
+func (f *rotatingFile) shouldRotate(next int) bool {
+	if f.size == 0 {
+		return false
+	}
+	if f.opts.MaxSize > 0 && f.size+int64(next) > f.opts.MaxSize {
+		return true
+	}
+	return f.opts.MaxAge > 0 && f.now().Sub(f.opened) >= f.opts.MaxAge
+}
+
+func (f *rotatingFile) rotate() error {
+	err := f.archiveErr
+	f.archiveErr = nil
+	ext := filepath.Ext(f.opts.Path)
+	stem := strings.TrimSuffix(f.opts.Path, ext)
+	backup := stem + "-" + f.now().UTC().Format(backupLayout) + ext
+	closeErr := f.file.Close()
+	f.file = nil
+	renamed := false
+	if closeErr != nil {
+		err = errors.Join(err, fmt.Errorf("close log file: %w", closeErr))
+	} else if renameErr := os.Rename(f.opts.Path, backup); renameErr != nil {
+		err = errors.Join(err, fmt.Errorf("rotate log file: %w", renameErr))
+	} else {
+		renamed = true
+	}
+	if openErr := f.open(); openErr != nil {
+		return errors.Join(err, openErr)
+	}
+	if renamed {
+		previous, done := f.archived, make(chan struct{})
+		f.archived = done
+		f.pending.Add(1)
+		go f.archive(previous, done, backup, stem, ext)
+	}
+	return err
+}
+
+func (f *rotatingFile) archive(previous <-chan struct{}, done chan<- struct{}, backup, stem, ext string) {
+	defer f.pending.Done()
+	defer close(done)
+	if previous != nil {
+		<-previous
+	}
+	var err error
+	if f.opts.Compress {
+		if err = compressFile(backup); errors.Is(err, os.ErrNotExist) {
+			err = nil
+		}
+	}
+	if err == nil {
+		err = f.prune(stem, ext)
+	}
+	if err != nil {
+		f.mu.Lock()
+		f.archiveErr = errors.Join(f.archiveErr, err)
+		f.mu.Unlock()
+	}
+}
+
+func (f *rotatingFile) prune(stem, ext string) error {
+	if f.opts.MaxBackups <= 0 {
+		return nil
+	}
+	matches, err := filepath.Glob(stem + "-*" + ext + "*")
+	if err != nil {
+		return err
+	}
+	var backups []string
+	for _, match := range matches {
+		if isBackup(match, stem, ext) {
+			backups = append(backups, match)
+		}
+	}
+	sort.Strings(backups)
+	for len(backups) > f.opts.MaxBackups {
+		if err := os.Remove(backups[0]); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("remove old log file: %w", err)
+		}
+		backups = backups[1:]
+	}
+	return nil
+}
+
+func isBackup(path, stem, ext string) bool {
+	name, ok := strings.CutPrefix(strings.TrimSuffix(path, ".gz"), stem+"-")
+	if !ok {
+		return false
+	}
+	timestamp, ok := strings.CutSuffix(name, ext)
+	if !ok || len(timestamp) != len(backupLayout) {
+		return false
+	}
+	_, err := time.Parse(backupLayout, timestamp)
+	return err == nil
+}
+
+func (f *rotatingFile) Close() error {
+	f.mu.Lock()
+	var err error
+	if f.file != nil {
+		err = f.file.Close()
+		f.file = nil
+	}
+	f.mu.Unlock()
+	f.pending.Wait()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	err = errors.Join(err, f.archiveErr)
+	f.archiveErr = nil
+	return err
+}
+
+func compressFile(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("compress log file: %w", err)
+	}
+	defer src.Close()
+	dst, err := os.OpenFile(path+".gz", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return fmt.Errorf("compress log file: %w", err)
+	}
+	zw := gzip.NewWriter(dst)
+	if _, err := io.Copy(zw, src); err != nil {
+		dst.Close()
+		return fmt.Errorf("compress log file: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		dst.Close()
+		return fmt.Errorf("compress log file: %w", err)
+	}
+	if err := dst.Close(); err != nil {
+		return fmt.Errorf("compress log file: %w", err)
+	}
+	return os.Remove(path)
+}
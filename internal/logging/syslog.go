@@ -0,0 +1,194 @@
+package logging
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type SyslogOptions struct {
+	Network  string
+	Address  string
+	Facility string
+}
+
+var facilities = map[string]int{
+	"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5,
+	"lpr": 6, "news": 7, "uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19,
+	"local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+func parseFacility(name string) (int, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" {
+		return facilities["daemon"], nil
+	}
+	facility, ok := facilities[name]
+	if !ok {
+		return 0, fmt.Errorf("invalid syslog facility %s", name)
+	}
+	return facility, nil
+}
+
+type syslogSink struct {
+	mu       sync.Mutex
+	network  string
+	address  string
+	conn     net.Conn
+	framed   bool
+	facility int
+	tag      string
+	hostname string
+	pid      int
+}
+
+func newSyslogSink(opts SyslogOptions, tag string) (*syslogSink, error) {
+	facility, err := parseFacility(opts.Facility)
+	if err != nil {
+		return nil, err
+	}
+	network := opts.Network
+	if network == "" {
+		network = "udp"
+	}
+	switch network {
+	case "udp", "tcp", "unix":
+	default:
+		return nil, fmt.Errorf("invalid syslog network %s", network)
+	}
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "-"
+	}
+	s := &syslogSink{
+		network:  network,
+		address:  opts.Address,
+		facility: facility,
+		tag:      tag,
+		hostname: hostname,
+		pid:      os.Getpid(),
+	}
+	if err := s.connect(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *syslogSink) connect() error {
+	if s.network == "unix" {
+		conn, err := net.DialTimeout("unixgram", s.address, 5*time.Second)
+		if err == nil {
+			s.conn, s.framed = conn, false
+			return nil
+		}
+		conn, err = net.DialTimeout("unix", s.address, 5*time.Second)
+		if err != nil {
+			return fmt.Errorf("connect to syslog %s: %w", s.address, err)
+		}
+		s.conn, s.framed = conn, true
+		return nil
+	}
+	conn, err := net.DialTimeout(s.network, s.address, 5*time.Second)
+	if err != nil {
+		return fmt.Errorf("connect to syslog %s: %w", s.address, err)
+	}
+	s.conn, s.framed = conn, s.network == "tcp"
+	return nil
+}
+
+func (s *syslogSink) emit(r slog.Record, attrs []slog.Attr) error {
+	msg := s.format(r, attrs)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err := s.write(msg)
+	if err == nil {
+		return nil
+	}
+	if s.conn != nil {
+		s.conn.Close()
+		s.conn = nil
+	}
+	if err := s.connect(); err != nil {
+		return err
+	}
+	return s.write(msg)
+}
+
+func (s *syslogSink) write(msg []byte) error {
+	if s.conn == nil {
+		return net.ErrClosed
+	}
+	if s.framed {
+		msg = append([]byte(strconv.Itoa(len(msg))+" "), msg...)
+	}
+	_, err := s.conn.Write(msg)
+	return err
+}
+
+func (s *syslogSink) format(r slog.Record, attrs []slog.Attr) []byte {
+	var buf bytes.Buffer
+	timestamp := r.Time
+	if timestamp.IsZero() {
+		timestamp = time.Now()
+	}
+	fmt.Fprintf(&buf, "<%d>1 %s %s %s %d - ",
+		s.facility*8+severity(r.Level),
+		timestamp.Format("2006-01-02T15:04:05.000000Z07:00"),
+		s.hostname,
+		syslogField(s.tag, 48),
+		s.pid,
+	)
+	if len(attrs) == 0 {
+		buf.WriteString("-")
+	} else {
+		buf.WriteString("[meta@32473")
+		for _, a := range attrs {
+			fmt.Fprintf(&buf, " %s=\"%s\"", syslogField(a.Key, 32), sdEscaper.Replace(a.Value.String()))
+		}
+		buf.WriteString("]")
+	}
+	if r.Message != "" {
+		buf.WriteString(" ")
+		buf.WriteString(r.Message)
+	}
+	return buf.Bytes()
+}
+
+func (s *syslogSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
+
+var sdEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`)
+
+func syslogField(value string, limit int) string {
+	var b strings.Builder
+	for _, r := range value {
+		switch {
+		case r <= ' ' || r > '~' || r == '=' || r == ']' || r == '"':
+			b.WriteByte('_')
+		default:
+			b.WriteRune(r)
+		}
+		if b.Len() == limit {
+			break
+		}
+	}
+	if b.Len() == 0 {
+		return "-"
+	}
+	return b.String()
+}
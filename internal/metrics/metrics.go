@@ -0,0 +1,250 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/thealonlevi/subnet-sentinel/internal/checker"
+	"github.com/thealonlevi/subnet-sentinel/internal/config"
+)
+
+const namespace = "subnet_sentinel"
+
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+type histogram struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+type family struct {
+	name    string
+	help    string
+	kind    string
+	values  map[string]float64
+	buckets map[string]*histogram
+}
+
+type Registry struct {
+	mu       sync.Mutex
+	buckets  []float64
+	families []*family
+
+	runs      *family
+	probes    *family
+	failures  *family
+	durations *family
+	lastRun   *family
+	ratio     *family
+	sampled   *family
+	subnets   map[string]string
+}
+
+func New() *Registry {
+	r := &Registry{buckets: DefaultBuckets, subnets: make(map[string]string)}
+	r.runs = r.family("runs_total", "counter", "Completed check runs.")
+	r.probes = r.family("probes_total", "counter", "Probes sent, by subnet, target and result.")
+	r.failures = r.family("probe_failures_total", "counter", "Failed probes of non-quarantined source IPs, by error class.")
+	r.durations = r.family("probe_duration_seconds", "histogram", "Probe latency in seconds.")
+	r.lastRun = r.family("last_run_timestamp_seconds", "gauge", "Unix time at which the subnet was last checked.")
+	r.ratio = r.family("success_ratio", "gauge", "Share of successful probes in the last run of the subnet, quarantined IPs excluded.")
+	r.sampled = r.family("sampled_ips", "gauge", "Distinct source IPs probed in the last run of the subnet.")
+	return r
+}
+
+func (r *Registry) family(name, kind, help string) *family {
+	f := &family{
+		name:    namespace + "_" + name,
+		help:    help,
+		kind:    kind,
+		values:  make(map[string]float64),
+		buckets: make(map[string]*histogram),
+	}
+	r.families = append(r.families, f)
+	return f
+}
+
+func (r *Registry) Observe(report checker.Report) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.runs.values[""]++
+	sampled := make(map[string]map[string]bool)
+	for _, res := range report.Results {
+		subnet := subnetLabels(res.Subnet, res.Tags)
+		kind := "success"
+		switch {
+		case res.Quarantined:
+			kind = "quarantined"
+		case !res.Success:
+			kind = "failure"
+			r.failures.values[joinLabels(subnet, label("target", res.URL), label("class", checker.ErrorClass(res)))]++
+		}
+		r.probes.values[joinLabels(subnet, label("target", res.URL), label("result", kind))]++
+		r.observeDuration(joinLabels(subnet, label("target", res.URL), label("result", kind)), res.Duration.Seconds())
+		if sampled[res.Subnet] == nil {
+			sampled[res.Subnet] = make(map[string]bool)
+		}
+		sampled[res.Subnet][res.SourceIP] = true
+	}
+	timestamp := float64(report.End.UnixNano()) / 1e9
+	for _, summary := range checker.Summarize(report.Results) {
+		subnet := subnetLabels(summary.Subnet, summary.Tags)
+		if previous, ok := r.subnets[summary.Subnet]; ok && previous != subnet {
+			r.resetGauges(previous)
+		}
+		r.subnets[summary.Subnet] = subnet
+		r.lastRun.values[subnet] = timestamp
+		r.ratio.values[subnet] = summary.SuccessRatio()
+		r.sampled.values[subnet] = float64(len(sampled[summary.Subnet]))
+	}
+}
+
+func (r *Registry) Retain(cidrs []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	keep := make(map[string]bool, len(cidrs))
+	for _, cidr := range cidrs {
+		keep[cidr] = true
+	}
+	for cidr, labels := range r.subnets {
+		if !keep[cidr] {
+			r.resetGauges(labels)
+			delete(r.subnets, cidr)
+		}
+	}
+}
+
+func (r *Registry) resetGauges(labels string) {
+	for _, f := range []*family{r.lastRun, r.ratio, r.sampled} {
+		delete(f.values, labels)
+	}
+}
+
+func (r *Registry) observeDuration(labels string, seconds float64) {
+	h := r.durations.buckets[labels]
+	if h == nil {
+		h = &histogram{counts: make([]uint64, len(r.buckets))}
+		r.durations.buckets[labels] = h
+	}
+	for i, bound := range r.buckets {
+		if seconds <= bound {
+			h.counts[i]++
+		}
+	}
+	h.sum += seconds
+	h.count++
+}
+
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := &countingWriter{w: bufio.NewWriter(w)}
+	for _, f := range r.families {
+		fmt.Fprintf(out, "# HELP %s %s\n# TYPE %s %s\n", f.name, f.help, f.name, f.kind)
+		if f.kind == "histogram" {
+			for _, labels := range sortedKeys(f.buckets) {
+				h := f.buckets[labels]
+				for i, bound := range r.buckets {
+					fmt.Fprintf(out, "%s_bucket{%s} %d\n", f.name, joinLabels(labels, label("le", formatValue(bound))), h.counts[i])
+				}
+				fmt.Fprintf(out, "%s_bucket{%s} %d\n", f.name, joinLabels(labels, label("le", "+Inf")), h.count)
+				fmt.Fprintf(out, "%s_sum%s %s\n", f.name, braces(labels), formatValue(h.sum))
+				fmt.Fprintf(out, "%s_count%s %d\n", f.name, braces(labels), h.count)
+			}
+			continue
+		}
+		for _, labels := range sortedKeys(f.values) {
+			fmt.Fprintf(out, "%s%s %s\n", f.name, braces(labels), formatValue(f.values[labels]))
+		}
+	}
+	if err := out.w.Flush(); err != nil {
+		return out.n, err
+	}
+	return out.n, out.err
+}
+
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	r.WriteTo(w)
+}
+
+type countingWriter struct {
+	w   *bufio.Writer
+	n   int64
+	err error
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	c.err = err
+	return n, err
+}
+
+func subnetLabels(subnet string, tags map[string]string) string {
+	labels := []string{label("subnet", subnet)}
+	keys := make([]string, 0, len(tags))
+	for key := range tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		labels = append(labels, label(config.TagLabel(key), tags[key]))
+	}
+	return joinLabels(labels...)
+}
+
+func label(name, value string) string {
+	return name + `="` + labelEscaper.Replace(value) + `"`
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func joinLabels(labels ...string) string {
+	parts := make([]string, 0, len(labels))
+	for _, l := range labels {
+		if l != "" {
+			parts = append(parts, l)
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+func braces(labels string) string {
+	if labels == "" {
+		return ""
+	}
+	return "{" + labels + "}"
+}
+
+func formatValue(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
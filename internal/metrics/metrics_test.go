@@ -0,0 +1,105 @@
+package metrics
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/thealonlevi/subnet-sentinel/internal/checker"
+)
+
+func TestRegistryExposesRunMetrics(t *testing.T) {
+	registry := New()
+	tags := map[string]string{"customer": "acme", "pop-name": "fra"}
+	end := time.Unix(1760000000, 0)
+	registry.Observe(checker.Report{
+		End: end,
+		Results: []checker.Result{
+			{Subnet: "10.0.0.0/24", SourceIP: "10.0.0.1", URL: "https://a.example", Success: true, StatusCode: 200, Duration: 40 * time.Millisecond, Tags: tags},
+			{Subnet: "10.0.0.0/24", SourceIP: "10.0.0.1", URL: "https://b.example", Success: true, StatusCode: 200, Duration: 3 * time.Second, Tags: tags},
+			{Subnet: "10.0.0.0/24", SourceIP: "10.0.0.2", URL: "https://a.example", Error: "connect: connection refused", Tags: tags},
+			{Subnet: "10.0.0.0/24", SourceIP: "10.0.0.3", URL: "https://a.example", Error: "unexpected status 502", StatusCode: 502, Quarantined: true, Tags: tags},
+		},
+	})
+	registry.Observe(checker.Report{End: end, Results: []checker.Result{
+		{Subnet: "10.1.0.0/24", SourceIP: "10.1.0.9", URL: `https://c.example/"q"`, Success: true, Duration: time.Millisecond},
+	}})
+	var buf bytes.Buffer
+	if _, err := registry.WriteTo(&buf); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	out := buf.String()
+	subnet := `subnet="10.0.0.0/24",tag_customer="acme",tag_pop_name="fra"`
+	want := []string{
+		"# TYPE subnet_sentinel_probes_total counter",
+		"subnet_sentinel_runs_total 2",
+		`subnet_sentinel_probes_total{` + subnet + `,target="https://a.example",result="success"} 1`,
+		`subnet_sentinel_probes_total{` + subnet + `,target="https://a.example",result="failure"} 1`,
+		`subnet_sentinel_probes_total{` + subnet + `,target="https://a.example",result="quarantined"} 1`,
+		`subnet_sentinel_probe_failures_total{` + subnet + `,target="https://a.example",class="connection_refused"} 1`,
+		`subnet_sentinel_probe_duration_seconds_bucket{` + subnet + `,target="https://a.example",result="success",le="0.05"} 1`,
+		`subnet_sentinel_probe_duration_seconds_bucket{` + subnet + `,target="https://b.example",result="success",le="2.5"} 0`,
+		`subnet_sentinel_probe_duration_seconds_bucket{` + subnet + `,target="https://b.example",result="success",le="+Inf"} 1`,
+		`subnet_sentinel_probe_duration_seconds_sum{` + subnet + `,target="https://b.example",result="success"} 3`,
+		`subnet_sentinel_last_run_timestamp_seconds{` + subnet + `} 1.76e+09`,
+		`subnet_sentinel_success_ratio{` + subnet + `} 0.6666666666666666`,
+		`subnet_sentinel_sampled_ips{` + subnet + `} 3`,
+		`subnet_sentinel_probes_total{subnet="10.1.0.0/24",target="https://c.example/\"q\"",result="success"} 1`,
+	}
+	for _, line := range want {
+		if !strings.Contains(out, line+"\n") {
+			t.Fatalf("missing %q in\n%s", line, out)
+		}
+	}
+	if strings.Contains(out, `class="http_status"`) {
+		t.Fatalf("quarantined failures must not be counted as failures:\n%s", out)
+	}
+}
+
+func TestRegistryServesExposition(t *testing.T) {
+	registry := New()
+	rec := httptest.NewRecorder()
+	registry.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if rec.Code != 200 || !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/plain; version=0.0.4") {
+		t.Fatalf("unexpected response %d %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	if !strings.Contains(rec.Body.String(), "# HELP subnet_sentinel_sampled_ips ") {
+		t.Fatalf("unexpected body %q", rec.Body.String())
+	}
+	rec = httptest.NewRecorder()
+	registry.ServeHTTP(rec, httptest.NewRequest("POST", "/metrics", nil))
+	if rec.Code != 405 {
+		t.Fatalf("expected 405 for POST, got %d", rec.Code)
+	}
+}
+
+func TestRegistryDropsGaugesOfRemovedSubnets(t *testing.T) {
+	registry := New()
+	end := time.Unix(1760000000, 0)
+	registry.Observe(checker.Report{End: end, Results: []checker.Result{
+		{Subnet: "10.0.0.0/24", SourceIP: "10.0.0.1", URL: "https://a.example", Success: true},
+		{Subnet: "10.1.0.0/24", SourceIP: "10.1.0.1", URL: "https://a.example", Success: true, Tags: map[string]string{"pop": "fra"}},
+	}})
+	registry.Observe(checker.Report{End: end, Results: []checker.Result{
+		{Subnet: "10.1.0.0/24", SourceIP: "10.1.0.1", URL: "https://a.example", Success: true, Tags: map[string]string{"pop": "ams"}},
+	}})
+	registry.Retain([]string{"10.1.0.0/24"})
+	var buf bytes.Buffer
+	if _, err := registry.WriteTo(&buf); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	out := buf.String()
+	for _, gauge := range []string{"last_run_timestamp_seconds", "success_ratio", "sampled_ips"} {
+		if strings.Contains(out, "subnet_sentinel_"+gauge+`{subnet="10.0.0.0/24"}`) || strings.Contains(out, "subnet_sentinel_"+gauge+`{subnet="10.1.0.0/24",tag_pop="fra"}`) {
+			t.Fatalf("stale %s series left in\n%s", gauge, out)
+		}
+		if !strings.Contains(out, "subnet_sentinel_"+gauge+`{subnet="10.1.0.0/24",tag_pop="ams"}`) {
+			t.Fatalf("missing current %s series in\n%s", gauge, out)
+		}
+	}
+	if !strings.Contains(out, `subnet_sentinel_probes_total{subnet="10.0.0.0/24",target="https://a.example",result="success"} 1`) {
+		t.Fatalf("counters must be kept:\n%s", out)
+	}
+}
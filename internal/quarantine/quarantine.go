@@ -0,0 +1,189 @@
+package quarantine
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/thealonlevi/subnet-sentinel/internal/statefile"
+)
+
+const (
+	EventQuarantined = "quarantined"
+	EventReleased    = "released"
+)
+
+type Entry struct {
+	IP         string    `json:"ip"`
+	Subnet     string    `json:"subnet"`
+	Reason     string    `json:"reason"`
+	Since      time.Time `json:"since"`
+	LastTested time.Time `json:"lastTested"`
+	Successes  int       `json:"successes"`
+}
+
+type suspect struct {
+	Subnet   string `json:"subnet"`
+	Failures int    `json:"failures"`
+}
+
+type state struct {
+	Entries  []Entry            `json:"entries"`
+	Suspects map[string]suspect `json:"suspects"`
+}
+
+type Store struct {
+	FailureThreshold int
+	ReleaseAfter     int
+
+	mu       sync.Mutex
+	path     string
+	entries  map[string]*Entry
+	suspects map[string]suspect
+}
+
+func New(failureThreshold, releaseAfter int) *Store {
+	return &Store{
+		FailureThreshold: failureThreshold,
+		ReleaseAfter:     releaseAfter,
+		entries:          make(map[string]*Entry),
+		suspects:         make(map[string]suspect),
+	}
+}
+
+func Load(path string, failureThreshold, releaseAfter int) (*Store, error) {
+	store := New(failureThreshold, releaseAfter)
+	store.path = path
+	if path == "" {
+		return store, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read quarantine: %w", err)
+	}
+	var st state
+	if err := json.Unmarshal(data, &st); err != nil {
+		return nil, fmt.Errorf("parse quarantine %s: %w", path, err)
+	}
+	for i := range st.Entries {
+		entry := st.Entries[i]
+		store.entries[entry.IP] = &entry
+	}
+	for ip, s := range st.Suspects {
+		store.suspects[ip] = s
+	}
+	return store, nil
+}
+
+func (s *Store) Save() error {
+	if s.path == "" {
+		return nil
+	}
+	s.mu.Lock()
+	data, err := json.MarshalIndent(state{Entries: s.list(), Suspects: s.suspects}, "", "  ")
+	s.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("encode quarantine: %w", err)
+	}
+	return statefile.WriteAtomic(s.path, data)
+}
+
+func (s *Store) Observe(subnet string, ip net.IP, success bool, reason string, at time.Time) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := ip.String()
+	if entry, ok := s.entries[key]; ok {
+		entry.LastTested = at
+		if !success {
+			entry.Successes = 0
+			entry.Reason = reason
+			return ""
+		}
+		entry.Successes++
+		if entry.Successes >= s.ReleaseAfter {
+			delete(s.entries, key)
+			return EventReleased
+		}
+		return ""
+	}
+	if success {
+		delete(s.suspects, key)
+		return ""
+	}
+	sus := s.suspects[key]
+	sus.Subnet = subnet
+	sus.Failures++
+	if sus.Failures < s.FailureThreshold {
+		s.suspects[key] = sus
+		return ""
+	}
+	delete(s.suspects, key)
+	s.entries[key] = &Entry{
+		IP:         key,
+		Subnet:     subnet,
+		Reason:     reason,
+		Since:      at,
+		LastTested: at,
+	}
+	return EventQuarantined
+}
+
+func (s *Store) Quarantined(subnet string) []Entry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	result := make([]Entry, 0)
+	for _, entry := range s.list() {
+		if entry.Subnet == subnet {
+			result = append(result, entry)
+		}
+	}
+	return result
+}
+
+func (s *Store) List() []Entry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.list()
+}
+
+func (s *Store) Clear(ips ...string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(ips) == 0 {
+		cleared := len(s.entries)
+		s.entries = make(map[string]*Entry)
+		s.suspects = make(map[string]suspect)
+		return cleared
+	}
+	cleared := 0
+	for _, ip := range ips {
+		if _, ok := s.entries[ip]; ok {
+			delete(s.entries, ip)
+			cleared++
+		}
+		delete(s.suspects, ip)
+	}
+	return cleared
+}
+
+func (s *Store) list() []Entry {
+	result := make([]Entry, 0, len(s.entries))
+	for _, entry := range s.entries {
+		result = append(result, *entry)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Subnet != result[j].Subnet {
+			return result[i].Subnet < result[j].Subnet
+		}
+		return result[i].IP < result[j].IP
+	})
+	return result
+}
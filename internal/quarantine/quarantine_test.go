@@ -0,0 +1,68 @@
+package quarantine
+
+import (
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStoreQuarantinesAndReleases(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "quarantine.json")
+	store, err := Load(path, 3, 2)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	ip := net.ParseIP("10.0.0.5")
+	now := time.Now()
+	for i := 0; i < 2; i++ {
+		if event := store.Observe("10.0.0.0/24", ip, false, "blocked", now); event != "" {
+			t.Fatalf("unexpected event %s after %d failures", event, i+1)
+		}
+	}
+	if event := store.Observe("10.0.0.0/24", ip, true, "", now); event != "" {
+		t.Fatalf("unexpected event %s on success", event)
+	}
+	for i := 0; i < 2; i++ {
+		store.Observe("10.0.0.0/24", ip, false, "blocked", now)
+	}
+	if len(store.List()) != 0 {
+		t.Fatalf("expected success to reset consecutive failures")
+	}
+	if event := store.Observe("10.0.0.0/24", ip, false, "blocked", now); event != EventQuarantined {
+		t.Fatalf("expected quarantine after 3 consecutive failures, got %q", event)
+	}
+	if err := store.Save(); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	loaded, err := Load(path, 3, 2)
+	if err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	entries := loaded.Quarantined("10.0.0.0/24")
+	if len(entries) != 1 || entries[0].IP != "10.0.0.5" || entries[0].Reason != "blocked" {
+		t.Fatalf("unexpected quarantine entries %+v", entries)
+	}
+	if event := loaded.Observe("10.0.0.0/24", ip, true, "", now); event != "" {
+		t.Fatalf("unexpected event %s after first success", event)
+	}
+	if event := loaded.Observe("10.0.0.0/24", ip, true, "", now); event != EventReleased {
+		t.Fatalf("expected release after 2 successes, got %q", event)
+	}
+	if len(loaded.List()) != 0 {
+		t.Fatalf("expected empty quarantine after release")
+	}
+}
+
+func TestStoreClear(t *testing.T) {
+	store := New(1, 1)
+	now := time.Now()
+	store.Observe("10.0.0.0/24", net.ParseIP("10.0.0.5"), false, "blocked", now)
+	store.Observe("10.0.0.0/24", net.ParseIP("10.0.0.6"), false, "blocked", now)
+	if cleared := store.Clear("10.0.0.5", "10.0.0.9"); cleared != 1 {
+		t.Fatalf("expected 1 entry cleared, got %d", cleared)
+	}
+	if cleared := store.Clear(); cleared != 1 {
+		t.Fatalf("expected remaining entry cleared, got %d", cleared)
+	}
+}
@@ -0,0 +1,45 @@
+package statefile
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteAtomicKeepsModeAndFollowsSymlinks(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "real", "config.yaml")
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.WriteFile(target, []byte("old"), 0o640); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := os.Chmod(target, 0o640); err != nil {
+		t.Fatalf("chmod: %v", err)
+	}
+	link := filepath.Join(dir, "config.yaml")
+	if err := os.Symlink(target, link); err != nil {
+		t.Fatalf("symlink: %v", err)
+	}
+	if err := WriteAtomic(link, []byte("new")); err != nil {
+		t.Fatalf("write atomic: %v", err)
+	}
+	if info, err := os.Lstat(link); err != nil || info.Mode()&os.ModeSymlink == 0 {
+		t.Fatalf("expected the symlink to be kept, got %v, %v", info, err)
+	}
+	info, err := os.Stat(target)
+	if err != nil || info.Mode().Perm() != 0o640 {
+		t.Fatalf("expected mode 0640 on the target, got %v, %v", info, err)
+	}
+	if data, _ := os.ReadFile(target); string(data) != "new" {
+		t.Fatalf("target content %q", data)
+	}
+	created := filepath.Join(dir, "report.xml")
+	if err := WriteAtomic(created, []byte("x")); err != nil {
+		t.Fatalf("write new file: %v", err)
+	}
+	if info, err := os.Stat(created); err != nil || info.Mode().Perm() != 0o644 {
+		t.Fatalf("expected mode 0644 on a new file, got %v, %v", info, err)
+	}
+}
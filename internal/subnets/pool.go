@@ -0,0 +1,207 @@
+package subnets
+
+import (
+	"fmt"
+	mathrand "math/rand"
+	"net"
+	"sort"
+)
+
+type hostRange struct {
+	first uint32
+	last  uint32
+}
+
+func (r hostRange) size() uint64 {
+	return uint64(r.last-r.first) + 1
+}
+
+type HostPool struct {
+	name    string
+	ranges  []hostRange
+	offsets []uint64
+	size    uint64
+}
+
+func NewHostPool(ipNet *net.IPNet, excludes []net.IP) (*HostPool, error) {
+	network := ipNet.IP.Mask(ipNet.Mask).To4()
+	if network == nil {
+		return nil, fmt.Errorf("only ipv4 supported")
+	}
+	maskSize, bits := ipNet.Mask.Size()
+	if bits != 32 {
+		return nil, fmt.Errorf("only ipv4 supported")
+	}
+	hostCount := uint64(1) << uint(32-maskSize)
+	if hostCount <= 2 {
+		return nil, fmt.Errorf("subnet %s has no assignable hosts", ipNet.String())
+	}
+	networkVal := IPToUint32(network)
+	firstHost := networkVal + 1
+	lastHost := networkVal + uint32(hostCount-2)
+	vals := make([]uint32, 0, len(excludes))
+	for _, ip := range excludes {
+		ip4 := ip.To4()
+		if ip4 == nil {
+			continue
+		}
+		val := IPToUint32(ip4)
+		if val < firstHost || val > lastHost {
+			continue
+		}
+		vals = append(vals, val)
+	}
+	sort.Slice(vals, func(i, j int) bool { return vals[i] < vals[j] })
+	ranges := make([]hostRange, 0, len(vals)+1)
+	next := uint64(firstHost)
+	for _, val := range vals {
+		if uint64(val) < next {
+			continue
+		}
+		if uint64(val) > next {
+			ranges = append(ranges, hostRange{first: uint32(next), last: val - 1})
+		}
+		next = uint64(val) + 1
+	}
+	if next <= uint64(lastHost) {
+		ranges = append(ranges, hostRange{first: uint32(next), last: lastHost})
+	}
+	return newHostPool(ipNet.String(), ranges), nil
+}
+
+func newHostPool(name string, ranges []hostRange) *HostPool {
+	pool := &HostPool{
+		name:    name,
+		ranges:  ranges,
+		offsets: make([]uint64, len(ranges)),
+	}
+	for i, r := range ranges {
+		pool.offsets[i] = pool.size
+		pool.size += r.size()
+	}
+	return pool
+}
+
+func (p *HostPool) Size() int {
+	return int(p.size)
+}
+
+func (p *HostPool) At(index int) net.IP {
+	return Uint32ToIP(p.valueAt(uint64(index)))
+}
+
+func (p *HostPool) valueAt(index uint64) uint32 {
+	i := sort.Search(len(p.ranges), func(i int) bool {
+		return p.offsets[i]+p.ranges[i].size() > index
+	})
+	return p.ranges[i].first + uint32(index-p.offsets[i])
+}
+
+func (p *HostPool) Contains(ip net.IP) bool {
+	ip4 := ip.To4()
+	if ip4 == nil {
+		return false
+	}
+	val := IPToUint32(ip4)
+	i := sort.Search(len(p.ranges), func(i int) bool {
+		return p.ranges[i].last >= val
+	})
+	return i < len(p.ranges) && p.ranges[i].first <= val
+}
+
+func (p *HostPool) Sample(r *mathrand.Rand, count int) ([]net.IP, error) {
+	if count <= 0 {
+		return nil, fmt.Errorf("count must be positive")
+	}
+	if uint64(count) > p.size {
+		return nil, fmt.Errorf("subnet %s does not have enough available hosts", p.name)
+	}
+	n := int64(p.size)
+	chosen := make(map[int64]struct{}, count)
+	indices := make([]int64, 0, count)
+	for j := n - int64(count); j < n; j++ {
+		t := r.Int63n(j + 1)
+		if _, ok := chosen[t]; ok {
+			t = j
+		}
+		chosen[t] = struct{}{}
+		indices = append(indices, t)
+	}
+	r.Shuffle(len(indices), func(i, j int) {
+		indices[i], indices[j] = indices[j], indices[i]
+	})
+	results := make([]net.IP, 0, count)
+	for _, index := range indices {
+		results = append(results, Uint32ToIP(p.valueAt(uint64(index))))
+	}
+	return results, nil
+}
+
+func (p *HostPool) Blocks(prefix int) []*HostPool {
+	blockSize := uint64(1) << uint(32-prefix)
+	blocks := make([]*HostPool, 0)
+	var current []hostRange
+	var currentStart uint64
+	flush := func() {
+		if len(current) == 0 {
+			return
+		}
+		name := fmt.Sprintf("%s/%d", Uint32ToIP(uint32(currentStart)), prefix)
+		blocks = append(blocks, newHostPool(name, current))
+		current = nil
+	}
+	for _, r := range p.ranges {
+		first := uint64(r.first)
+		last := uint64(r.last)
+		for first <= last {
+			blockStart := first - first%blockSize
+			blockEnd := blockStart + blockSize - 1
+			if len(current) > 0 && blockStart != currentStart {
+				flush()
+			}
+			currentStart = blockStart
+			end := last
+			if blockEnd < end {
+				end = blockEnd
+			}
+			current = append(current, hostRange{first: uint32(first), last: uint32(end)})
+			first = end + 1
+		}
+	}
+	flush()
+	return blocks
+}
+
+func (p *HostPool) Without(ips []net.IP) *HostPool {
+	vals := make([]uint32, 0, len(ips))
+	for _, ip := range ips {
+		if ip4 := ip.To4(); ip4 != nil {
+			vals = append(vals, IPToUint32(ip4))
+		}
+	}
+	sort.Slice(vals, func(i, j int) bool { return vals[i] < vals[j] })
+	ranges := make([]hostRange, 0, len(p.ranges)+len(vals))
+	v := 0
+	for _, r := range p.ranges {
+		next := uint64(r.first)
+		for v < len(vals) && uint64(vals[v]) <= uint64(r.last) {
+			val := uint64(vals[v])
+			v++
+			if val < next {
+				continue
+			}
+			if val > next {
+				ranges = append(ranges, hostRange{first: uint32(next), last: uint32(val - 1)})
+			}
+			next = val + 1
+		}
+		if next <= uint64(r.last) {
+			ranges = append(ranges, hostRange{first: uint32(next), last: r.last})
+		}
+	}
+	return newHostPool(p.name, ranges)
+}
+
+func (p *HostPool) Name() string {
+	return p.name
+}
@@ -0,0 +1,178 @@
+package subnets
+
+import (
+	"fmt"
+	"math"
+	mathrand "math/rand"
+	"net"
+	"testing"
+)
+
+func TestHostPoolSampleProperties(t *testing.T) {
+	r := mathrand.New(mathrand.NewSource(1))
+	for trial := 0; trial < 500; trial++ {
+		prefix := 20 + r.Intn(10)
+		base := uint32(10<<24) | uint32(r.Intn(1<<16))<<8
+		_, ipNet, err := net.ParseCIDR(fmt.Sprintf("%s/%d", Uint32ToIP(base), prefix))
+		if err != nil {
+			t.Fatalf("parse cidr: %v", err)
+		}
+		network := IPToUint32(ipNet.IP)
+		hostCount := uint32(1) << uint(32-prefix)
+		excludeSet := make(map[uint32]struct{})
+		excludes := make([]net.IP, 0)
+		for i := r.Intn(int(hostCount)); i > 0; i-- {
+			val := network + uint32(r.Intn(int(hostCount)))
+			excludeSet[val] = struct{}{}
+			excludes = append(excludes, Uint32ToIP(val))
+		}
+		available := 0
+		for val := network + 1; val < network+hostCount-1; val++ {
+			if _, ok := excludeSet[val]; !ok {
+				available++
+			}
+		}
+		pool, err := NewHostPool(ipNet, excludes)
+		if err != nil {
+			t.Fatalf("build pool for %s: %v", ipNet, err)
+		}
+		if pool.Size() != available {
+			t.Fatalf("expected pool size %d for %s, got %d", available, ipNet, pool.Size())
+		}
+		if available == 0 {
+			continue
+		}
+		count := 1 + r.Intn(available)
+		hosts, err := pool.Sample(r, count)
+		if err != nil {
+			t.Fatalf("sample %d of %d from %s: %v", count, available, ipNet, err)
+		}
+		if len(hosts) != count {
+			t.Fatalf("expected %d hosts, got %d", count, len(hosts))
+		}
+		seen := make(map[uint32]struct{})
+		for _, host := range hosts {
+			val := IPToUint32(host)
+			if val <= network || val >= network+hostCount-1 {
+				t.Fatalf("host %s is not assignable in %s", host, ipNet)
+			}
+			if _, ok := excludeSet[val]; ok {
+				t.Fatalf("excluded host %s selected", host)
+			}
+			if _, ok := seen[val]; ok {
+				t.Fatalf("duplicate host %s selected", host)
+			}
+			seen[val] = struct{}{}
+		}
+	}
+}
+
+func TestHostPoolSampleDenseExclusions(t *testing.T) {
+	_, ipNet, err := net.ParseCIDR("10.20.0.0/16")
+	if err != nil {
+		t.Fatalf("parse cidr: %v", err)
+	}
+	keep := map[uint32]struct{}{}
+	for _, host := range []string{"10.20.0.1", "10.20.17.4", "10.20.99.99", "10.20.128.0", "10.20.255.254"} {
+		keep[IPToUint32(net.ParseIP(host))] = struct{}{}
+	}
+	network := IPToUint32(ipNet.IP)
+	excludes := make([]net.IP, 0, 1<<16)
+	for val := network; val < network+1<<16; val++ {
+		if _, ok := keep[val]; !ok {
+			excludes = append(excludes, Uint32ToIP(val))
+		}
+	}
+	hosts, err := RandomHosts(ipNet, excludes, len(keep))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	for _, host := range hosts {
+		if _, ok := keep[IPToUint32(host)]; !ok {
+			t.Fatalf("unexpected host %s selected", host)
+		}
+		delete(keep, IPToUint32(host))
+	}
+	if len(keep) != 0 {
+		t.Fatalf("expected every remaining host to be selected, %d missing", len(keep))
+	}
+	if _, err := RandomHosts(ipNet, excludes, 6); err == nil {
+		t.Fatalf("expected error when requesting more hosts than available")
+	}
+}
+
+func TestHostPoolSampleUniform(t *testing.T) {
+	_, ipNet, err := net.ParseCIDR("192.168.1.0/28")
+	if err != nil {
+		t.Fatalf("parse cidr: %v", err)
+	}
+	excludes := []net.IP{net.ParseIP("192.168.1.3"), net.ParseIP("192.168.1.9")}
+	pool, err := NewHostPool(ipNet, excludes)
+	if err != nil {
+		t.Fatalf("build pool: %v", err)
+	}
+	if pool.Size() != 12 {
+		t.Fatalf("expected 12 hosts, got %d", pool.Size())
+	}
+	r := mathrand.New(mathrand.NewSource(7))
+	const trials = 60000
+	const perTrial = 3
+	counts := make(map[string]int)
+	firsts := make(map[string]int)
+	for i := 0; i < trials; i++ {
+		hosts, err := pool.Sample(r, perTrial)
+		if err != nil {
+			t.Fatalf("sample: %v", err)
+		}
+		for _, host := range hosts {
+			counts[host.String()]++
+		}
+		firsts[hosts[0].String()]++
+	}
+	if len(counts) != pool.Size() {
+		t.Fatalf("expected every host to be selected, got %d distinct", len(counts))
+	}
+	const critical = 31.26
+	if chi := chiSquare(counts, float64(trials*perTrial)/12); chi > critical {
+		t.Fatalf("host selection not uniform: chi-square %.2f", chi)
+	}
+	if chi := chiSquare(firsts, float64(trials)/12); chi > critical {
+		t.Fatalf("selection order not uniform: chi-square %.2f", chi)
+	}
+}
+
+func TestHostPoolContainsAndAt(t *testing.T) {
+	_, ipNet, err := net.ParseCIDR("172.16.0.0/29")
+	if err != nil {
+		t.Fatalf("parse cidr: %v", err)
+	}
+	pool, err := NewHostPool(ipNet, []net.IP{net.ParseIP("172.16.0.2"), net.ParseIP("172.16.0.5")})
+	if err != nil {
+		t.Fatalf("build pool: %v", err)
+	}
+	expected := []string{"172.16.0.1", "172.16.0.3", "172.16.0.4", "172.16.0.6"}
+	if pool.Size() != len(expected) {
+		t.Fatalf("expected %d hosts, got %d", len(expected), pool.Size())
+	}
+	for i, host := range expected {
+		if got := pool.At(i).String(); got != host {
+			t.Fatalf("expected host %d to be %s, got %s", i, host, got)
+		}
+		if !pool.Contains(net.ParseIP(host)) {
+			t.Fatalf("expected pool to contain %s", host)
+		}
+	}
+	for _, host := range []string{"172.16.0.0", "172.16.0.2", "172.16.0.5", "172.16.0.7", "172.16.0.8"} {
+		if pool.Contains(net.ParseIP(host)) {
+			t.Fatalf("expected pool not to contain %s", host)
+		}
+	}
+}
+
+func chiSquare(counts map[string]int, expected float64) float64 {
+	sum := 0.0
+	for _, count := range counts {
+		sum += math.Pow(float64(count)-expected, 2) / expected
+	}
+	return sum
+}
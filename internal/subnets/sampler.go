@@ -0,0 +1,176 @@
+package subnets
+
+import (
+	"fmt"
+	mathrand "math/rand"
+	"net"
+	"sync"
+
+	"github.com/thealonlevi/subnet-sentinel/internal/config"
+)
+
+const defaultBlockPrefix = 24
+
+type Sampler interface {
+	Select(r *mathrand.Rand, pool *HostPool, count int) ([]net.IP, error)
+}
+
+func NewSampler(subnet Subnet) (Sampler, error) {
+	switch subnet.Sampling.Strategy {
+	case "", config.SamplingRandom:
+		return RandomSampler{}, nil
+	case config.SamplingStratified:
+		prefix := subnet.Sampling.BlockPrefix
+		if prefix == 0 {
+			prefix = defaultBlockPrefix
+		}
+		return StratifiedSampler{BlockPrefix: prefix}, nil
+	case config.SamplingSweep:
+		return &SweepSampler{}, nil
+	case config.SamplingSticky:
+		canaries := make([]net.IP, 0, len(subnet.Sampling.Canaries))
+		for _, host := range subnet.Sampling.Canaries {
+			canaries = append(canaries, net.ParseIP(host).To4())
+		}
+		canaryCount := subnet.Sampling.CanaryCount
+		if len(canaries) == 0 && canaryCount == 0 {
+			canaryCount = 1
+		}
+		return &StickySampler{Canaries: canaries, CanaryCount: canaryCount}, nil
+	default:
+		return nil, fmt.Errorf("subnet %s unknown sampling strategy %s", subnet.CIDR, subnet.Sampling.Strategy)
+	}
+}
+
+type RandomSampler struct{}
+
+func (RandomSampler) Select(r *mathrand.Rand, pool *HostPool, count int) ([]net.IP, error) {
+	return pool.Sample(r, count)
+}
+
+type StratifiedSampler struct {
+	BlockPrefix int
+}
+
+func (s StratifiedSampler) Select(r *mathrand.Rand, pool *HostPool, count int) ([]net.IP, error) {
+	if count <= 0 {
+		return nil, fmt.Errorf("count must be positive")
+	}
+	if count > pool.Size() {
+		return nil, fmt.Errorf("subnet %s does not have enough available hosts", pool.Name())
+	}
+	blocks := pool.Blocks(s.BlockPrefix)
+	r.Shuffle(len(blocks), func(i, j int) {
+		blocks[i], blocks[j] = blocks[j], blocks[i]
+	})
+	quotas := make([]int, len(blocks))
+	remaining := count
+	for remaining > 0 {
+		for i, block := range blocks {
+			if remaining == 0 {
+				break
+			}
+			if quotas[i] < block.Size() {
+				quotas[i]++
+				remaining--
+			}
+		}
+	}
+	results := make([]net.IP, 0, count)
+	for i, block := range blocks {
+		if quotas[i] == 0 {
+			continue
+		}
+		hosts, err := block.Sample(r, quotas[i])
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, hosts...)
+	}
+	return results, nil
+}
+
+type SweepSampler struct {
+	mu   sync.Mutex
+	next int
+}
+
+func (s *SweepSampler) Select(r *mathrand.Rand, pool *HostPool, count int) ([]net.IP, error) {
+	if count <= 0 {
+		return nil, fmt.Errorf("count must be positive")
+	}
+	if count > pool.Size() {
+		return nil, fmt.Errorf("subnet %s does not have enough available hosts", pool.Name())
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	results := make([]net.IP, 0, count)
+	for i := 0; i < count; i++ {
+		results = append(results, pool.At((s.next+i)%pool.Size()))
+	}
+	s.next = (s.next + count) % pool.Size()
+	return results, nil
+}
+
+type StickySampler struct {
+	Canaries    []net.IP
+	CanaryCount int
+
+	mu     sync.Mutex
+	picked []net.IP
+}
+
+func (s *StickySampler) Select(r *mathrand.Rand, pool *HostPool, count int) ([]net.IP, error) {
+	if count <= 0 {
+		return nil, fmt.Errorf("count must be positive")
+	}
+	canaries, err := s.canaries(r, pool)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]net.IP, 0, count)
+	seen := make(map[string]bool, len(canaries))
+	for _, canary := range canaries {
+		if len(results) == count {
+			break
+		}
+		if seen[canary.String()] || !pool.Contains(canary) {
+			continue
+		}
+		seen[canary.String()] = true
+		results = append(results, canary)
+	}
+	extra := count - len(results)
+	if extra <= 0 {
+		return results, nil
+	}
+	rest := pool.Without(canaries)
+	if extra > rest.Size() {
+		return nil, fmt.Errorf("subnet %s does not have enough available hosts", pool.Name())
+	}
+	hosts, err := rest.Sample(r, extra)
+	if err != nil {
+		return nil, err
+	}
+	return append(results, hosts...), nil
+}
+
+func (s *StickySampler) canaries(r *mathrand.Rand, pool *HostPool) ([]net.IP, error) {
+	if len(s.Canaries) > 0 {
+		return s.Canaries, nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.picked == nil {
+		count := s.CanaryCount
+		if count > pool.Size() {
+			count = pool.Size()
+		}
+		picked, err := pool.Sample(r, count)
+		if err != nil {
+			return nil, err
+		}
+		s.picked = picked
+	}
+	return s.picked, nil
+}
@@ -0,0 +1,165 @@
+package subnets
+
+import (
+	"fmt"
+	mathrand "math/rand"
+	"net"
+	"testing"
+
+	"github.com/thealonlevi/subnet-sentinel/internal/config"
+)
+
+func samplerSubnet(t *testing.T, cidr string, sampling config.SamplingConfig, excludes ...string) Subnet {
+	t.Helper()
+	subs, err := FromConfigs([]config.SubnetConfig{{CIDR: cidr, ExcludeHosts: excludes, Sampling: sampling}})
+	if err != nil {
+		t.Fatalf("subnet parse: %v", err)
+	}
+	return subs[0]
+}
+
+func TestStratifiedSamplerCoversEveryBlock(t *testing.T) {
+	subnet := samplerSubnet(t, "154.208.64.0/21", config.SamplingConfig{Strategy: config.SamplingStratified})
+	sampler, err := NewSampler(subnet)
+	if err != nil {
+		t.Fatalf("sampler init: %v", err)
+	}
+	r := mathrand.New(mathrand.NewSource(3))
+	for trial := 0; trial < 50; trial++ {
+		hosts, err := sampler.Select(r, subnet.Pool, 8)
+		if err != nil {
+			t.Fatalf("select: %v", err)
+		}
+		blocks := make(map[byte]int)
+		for _, host := range hosts {
+			blocks[host.To4()[2]]++
+		}
+		if len(blocks) != 8 {
+			t.Fatalf("expected one host in each of 8 /24 blocks, got %v", blocks)
+		}
+	}
+}
+
+func TestStratifiedSamplerSpillsOverSmallBlocks(t *testing.T) {
+	excludes := make([]string, 0)
+	for i := 1; i < 255; i++ {
+		if i != 10 {
+			excludes = append(excludes, net.IPv4(10, 0, 0, byte(i)).String())
+		}
+	}
+	subnet := samplerSubnet(t, "10.0.0.0/23", config.SamplingConfig{Strategy: config.SamplingStratified}, excludes...)
+	sampler, err := NewSampler(subnet)
+	if err != nil {
+		t.Fatalf("sampler init: %v", err)
+	}
+	hosts, err := sampler.Select(mathrand.New(mathrand.NewSource(1)), subnet.Pool, 6)
+	if err != nil {
+		t.Fatalf("select: %v", err)
+	}
+	if len(hosts) != 6 {
+		t.Fatalf("expected 6 hosts, got %d", len(hosts))
+	}
+	seen := make(map[string]struct{})
+	for _, host := range hosts {
+		if _, ok := seen[host.String()]; ok {
+			t.Fatalf("duplicate host %s selected", host)
+		}
+		seen[host.String()] = struct{}{}
+	}
+	if _, ok := seen["10.0.0.10"]; !ok {
+		t.Fatalf("expected only host of first block to be selected")
+	}
+}
+
+func TestSweepSamplerVisitsEveryHostOnce(t *testing.T) {
+	subnet := samplerSubnet(t, "10.1.0.0/27", config.SamplingConfig{Strategy: config.SamplingSweep}, "10.1.0.4")
+	sampler, err := NewSampler(subnet)
+	if err != nil {
+		t.Fatalf("sampler init: %v", err)
+	}
+	r := mathrand.New(mathrand.NewSource(1))
+	seen := make(map[string]int)
+	for cycle := 0; cycle < 29; cycle++ {
+		hosts, err := sampler.Select(r, subnet.Pool, 3)
+		if err != nil {
+			t.Fatalf("select: %v", err)
+		}
+		for _, host := range hosts {
+			seen[host.String()]++
+		}
+	}
+	if len(seen) != subnet.Pool.Size() {
+		t.Fatalf("expected %d hosts visited, got %d", subnet.Pool.Size(), len(seen))
+	}
+	for host, visits := range seen {
+		if visits != 3 {
+			t.Fatalf("expected host %s visited 3 times over 3 sweeps, got %d", host, visits)
+		}
+	}
+}
+
+func TestStickySamplerKeepsCanaries(t *testing.T) {
+	subnet := samplerSubnet(t, "10.2.0.0/24", config.SamplingConfig{Strategy: config.SamplingSticky, Canaries: []string{"10.2.0.10", "10.2.0.20"}})
+	sampler, err := NewSampler(subnet)
+	if err != nil {
+		t.Fatalf("sampler init: %v", err)
+	}
+	r := mathrand.New(mathrand.NewSource(1))
+	for trial := 0; trial < 20; trial++ {
+		hosts, err := sampler.Select(r, subnet.Pool, 5)
+		if err != nil {
+			t.Fatalf("select: %v", err)
+		}
+		if len(hosts) != 5 {
+			t.Fatalf("expected 5 hosts, got %d", len(hosts))
+		}
+		if hosts[0].String() != "10.2.0.10" || hosts[1].String() != "10.2.0.20" {
+			t.Fatalf("expected canaries first, got %v", hosts[:2])
+		}
+		for _, host := range hosts[2:] {
+			if host.String() == "10.2.0.10" || host.String() == "10.2.0.20" {
+				t.Fatalf("canary %s selected as extra", host)
+			}
+		}
+	}
+}
+
+func TestStickySamplerCapsAndDedupesCanaries(t *testing.T) {
+	subnet := samplerSubnet(t, "10.4.0.0/24", config.SamplingConfig{Strategy: config.SamplingSticky, Canaries: []string{"10.4.0.10", "10.4.0.20", "10.4.0.10", "10.4.0.30"}})
+	sampler, err := NewSampler(subnet)
+	if err != nil {
+		t.Fatalf("sampler init: %v", err)
+	}
+	r := mathrand.New(mathrand.NewSource(1))
+	for count, want := range map[int]string{2: "[10.4.0.10 10.4.0.20]", 3: "[10.4.0.10 10.4.0.20 10.4.0.30]"} {
+		hosts, err := sampler.Select(r, subnet.Pool, count)
+		if err != nil {
+			t.Fatalf("select: %v", err)
+		}
+		if got := fmt.Sprint(hosts); got != want {
+			t.Fatalf("count %d: expected %s, got %s", count, want, got)
+		}
+	}
+}
+
+func TestStickySamplerPicksCanariesOnce(t *testing.T) {
+	subnet := samplerSubnet(t, "10.3.0.0/24", config.SamplingConfig{Strategy: config.SamplingSticky, CanaryCount: 2})
+	sampler, err := NewSampler(subnet)
+	if err != nil {
+		t.Fatalf("sampler init: %v", err)
+	}
+	r := mathrand.New(mathrand.NewSource(1))
+	first, err := sampler.Select(r, subnet.Pool, 2)
+	if err != nil {
+		t.Fatalf("select: %v", err)
+	}
+	for trial := 0; trial < 10; trial++ {
+		hosts, err := sampler.Select(r, subnet.Pool, 4)
+		if err != nil {
+			t.Fatalf("select: %v", err)
+		}
+		if !hosts[0].Equal(first[0]) || !hosts[1].Equal(first[1]) {
+			t.Fatalf("expected canaries %v to be kept, got %v", first, hosts[:2])
+		}
+	}
+}
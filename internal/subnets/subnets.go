@@ -4,9 +4,11 @@ import (
 	"crypto/rand"
 	"encoding/binary"
 	"fmt"
-	"math"
 	mathrand "math/rand"
 	"net"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/thealonlevi/subnet-sentinel/internal/config"
 )
@@ -16,6 +18,13 @@ type Subnet struct {
 	Network        *net.IPNet
 	ExcludeHosts   []net.IP
 	MountInterface string
+	Sampling       config.SamplingConfig
+	Targets        []string
+	IPsPerSubnet   int
+	Interval       time.Duration
+	Timeout        time.Duration
+	Tags           map[string]string
+	Pool           *HostPool
 }
 
 func FromConfigs(configs []config.SubnetConfig) ([]Subnet, error) {
@@ -49,81 +58,112 @@ func FromConfigs(configs []config.SubnetConfig) ([]Subnet, error) {
 			}
 			excludes = append(excludes, append(net.IP(nil), hostIP...))
 		}
+		for _, host := range cfg.Sampling.Canaries {
+			hostIP := net.ParseIP(host)
+			if hostIP == nil || hostIP.To4() == nil {
+				return nil, fmt.Errorf("subnet %s invalid canary %s", cfg.CIDR, host)
+			}
+			if !ipNet.Contains(hostIP) {
+				return nil, fmt.Errorf("subnet %s canary %s outside subnet", cfg.CIDR, host)
+			}
+		}
+		pool, err := NewHostPool(ipNet, excludes)
+		if err != nil {
+			return nil, fmt.Errorf("subnet %s: %w", cfg.CIDR, err)
+		}
 		result = append(result, Subnet{
 			CIDR:           cfg.CIDR,
 			Network:        ipNet,
 			ExcludeHosts:   excludes,
 			MountInterface: cfg.MountInterface,
+			Sampling:       cfg.Sampling,
+			Targets:        append([]string(nil), cfg.Targets...),
+			IPsPerSubnet:   cfg.IPsPerSubnet,
+			Interval:       time.Duration(cfg.IntervalSeconds) * time.Second,
+			Timeout:        time.Duration(cfg.TimeoutSeconds) * time.Second,
+			Tags:           copyTags(cfg.Tags),
+			Pool:           pool,
 		})
 	}
 	return result, nil
 }
 
+func FilterByTags(subs []Subnet, selector map[string]string) []Subnet {
+	result := make([]Subnet, 0, len(subs))
+	for _, subnet := range subs {
+		if subnet.MatchesTags(selector) {
+			result = append(result, subnet)
+		}
+	}
+	return result
+}
+
+func (s Subnet) MatchesTags(selector map[string]string) bool {
+	for key, value := range selector {
+		if actual, ok := s.Tags[key]; !ok || actual != value {
+			return false
+		}
+	}
+	return true
+}
+
+func FormatTags(tags map[string]string) string {
+	keys := make([]string, 0, len(tags))
+	for key := range tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys))
+	for _, key := range keys {
+		parts = append(parts, key+"="+tags[key])
+	}
+	return strings.Join(parts, ",")
+}
+
+func copyTags(tags map[string]string) map[string]string {
+	if len(tags) == 0 {
+		return nil
+	}
+	result := make(map[string]string, len(tags))
+	for key, value := range tags {
+		result[key] = value
+	}
+	return result
+}
+
 func RandomHosts(ipNet *net.IPNet, excludes []net.IP, count int) ([]net.IP, error) {
 	if count <= 0 {
 		return nil, fmt.Errorf("count must be positive")
 	}
-	network := ipNet.IP.Mask(ipNet.Mask).To4()
-	if network == nil {
-		return nil, fmt.Errorf("only ipv4 supported")
+	pool, err := NewHostPool(ipNet, excludes)
+	if err != nil {
+		return nil, err
 	}
-	maskSize, bits := ipNet.Mask.Size()
-	if bits != 32 {
-		return nil, fmt.Errorf("only ipv4 supported")
-	}
-	hostBits := uint32(32 - maskSize)
-	hostCount := uint32(1 << hostBits)
-	if hostCount <= 2 {
-		return nil, fmt.Errorf("subnet %s has no assignable hosts", ipNet.String())
-	}
-	networkVal := ipToUint32(network)
-	firstHost := networkVal + 1
-	lastHost := networkVal + hostCount - 2
-	excludeSet := make(map[uint32]struct{})
-	for _, ip := range excludes {
-		ip4 := ip.To4()
-		if ip4 == nil {
-			continue
-		}
-		val := ipToUint32(ip4)
-		if val <= networkVal || val >= networkVal+hostCount-1 {
-			continue
-		}
-		excludeSet[val] = struct{}{}
+	r, err := NewRand()
+	if err != nil {
+		return nil, err
 	}
-	available := int(hostCount-2) - len(excludeSet)
-	if available < count {
-		return nil, fmt.Errorf("subnet %s does not have enough available hosts", ipNet.String())
+	return pool.Sample(r, count)
+}
+
+func NewRand() (*mathrand.Rand, error) {
+	seed, err := RandomSeed()
+	if err != nil {
+		return nil, err
 	}
+	return NewSeededRand(seed), nil
+}
+
+func NewSeededRand(seed int64) *mathrand.Rand {
+	return mathrand.New(mathrand.NewSource(seed))
+}
+
+func RandomSeed() (int64, error) {
 	seedBytes := make([]byte, 8)
 	if _, err := rand.Read(seedBytes); err != nil {
-		return nil, fmt.Errorf("seed randomness: %w", err)
-	}
-	seed := int64(binary.LittleEndian.Uint64(seedBytes))
-	r := mathrand.New(mathrand.NewSource(seed))
-	results := make([]net.IP, 0, count)
-	used := make(map[uint32]struct{})
-	maxAttempts := int(math.Max(float64(count*20), 100))
-	attempts := 0
-	for len(results) < count {
-		if attempts > maxAttempts {
-			return nil, fmt.Errorf("failed to select enough hosts for %s", ipNet.String())
-		}
-		attempts++
-		candidateVal := firstHost + uint32(r.Int63n(int64(lastHost-firstHost+1)))
-		if candidateVal <= networkVal || candidateVal >= networkVal+hostCount-1 {
-			continue
-		}
-		if _, ok := excludeSet[candidateVal]; ok {
-			continue
-		}
-		if _, ok := used[candidateVal]; ok {
-			continue
-		}
-		used[candidateVal] = struct{}{}
-		results = append(results, uint32ToIP(candidateVal))
+		return 0, fmt.Errorf("seed randomness: %w", err)
 	}
-	return results, nil
+	return int64(binary.LittleEndian.Uint64(seedBytes) >> 1), nil
 }
 
 func DeterministicHost(ipNet *net.IPNet, excludes []net.IP) (net.IP, error) {
@@ -140,13 +180,13 @@ func DeterministicHost(ipNet *net.IPNet, excludes []net.IP) (net.IP, error) {
 	if hostCount <= 2 {
 		return nil, fmt.Errorf("subnet %s has no assignable hosts", ipNet.String())
 	}
-	networkVal := ipToUint32(network)
+	networkVal := IPToUint32(network)
 	firstHost := networkVal + 1
 	lastHost := networkVal + hostCount - 2
 	excludeSet := make(map[uint32]struct{})
 	for _, ip := range excludes {
 		if ip4 := ip.To4(); ip4 != nil {
-			val := ipToUint32(ip4)
+			val := IPToUint32(ip4)
 			if val >= firstHost && val <= lastHost {
 				excludeSet[val] = struct{}{}
 			}
@@ -164,17 +204,17 @@ func DeterministicHost(ipNet *net.IPNet, excludes []net.IP) (net.IP, error) {
 		if _, ok := excludeSet[candidate]; ok {
 			continue
 		}
-		return uint32ToIP(candidate), nil
+		return Uint32ToIP(candidate), nil
 	}
 	return nil, fmt.Errorf("no available host in %s", ipNet.String())
 }
 
-func ipToUint32(ip net.IP) uint32 {
+func IPToUint32(ip net.IP) uint32 {
 	ip4 := ip.To4()
 	return binary.BigEndian.Uint32(ip4)
 }
 
-func uint32ToIP(v uint32) net.IP {
+func Uint32ToIP(v uint32) net.IP {
 	ip := make(net.IP, net.IPv4len)
 	binary.BigEndian.PutUint32(ip, v)
 	return ip
@@ -75,3 +75,28 @@ func TestRandomHostsRespectsExclusions(t *testing.T) {
 		}
 	}
 }
+
+func TestFilterByTags(t *testing.T) {
+	subs, err := FromConfigs([]config.SubnetConfig{
+		{CIDR: "10.0.0.0/24", Tags: map[string]string{"provider": "cogent", "pop": "fra"}},
+		{CIDR: "10.0.1.0/24", Tags: map[string]string{"provider": "cogent", "pop": "ams"}},
+		{CIDR: "10.0.2.0/24", Tags: map[string]string{"provider": "lumen"}},
+		{CIDR: "10.0.3.0/24"},
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if matched := FilterByTags(subs, map[string]string{"provider": "cogent"}); len(matched) != 2 {
+		t.Fatalf("expected 2 cogent subnets, got %d", len(matched))
+	}
+	matched := FilterByTags(subs, map[string]string{"provider": "cogent", "pop": "ams"})
+	if len(matched) != 1 || matched[0].CIDR != "10.0.1.0/24" {
+		t.Fatalf("expected only 10.0.1.0/24, got %v", matched)
+	}
+	if matched := FilterByTags(subs, nil); len(matched) != 4 {
+		t.Fatalf("expected empty selector to match all subnets, got %d", len(matched))
+	}
+	if tags := FormatTags(subs[0].Tags); tags != "pop=fra,provider=cogent" {
+		t.Fatalf("unexpected formatted tags %s", tags)
+	}
+}
@@ -0,0 +1,95 @@
+package validate
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+
+	"github.com/thealonlevi/subnet-sentinel/internal/config"
+	"github.com/thealonlevi/subnet-sentinel/internal/subnets"
+)
+
+func Run(path string, opts config.LoadOptions) *config.Diagnostics {
+	diags := config.Diagnose(path, opts)
+	cfg := diags.Config
+	for i, target := range cfg.Targets {
+		checkTarget(diags, fmt.Sprintf("targets[%d]", i), target)
+	}
+	for i, subnet := range cfg.Subnets {
+		checkSubnet(diags, cfg, fmt.Sprintf("subnets[%d]", i), subnet)
+	}
+	diags.Sort()
+	return diags
+}
+
+func checkTarget(diags *config.Diagnostics, path string, target string) {
+	if target == "" {
+		return
+	}
+	parsed, err := url.Parse(target)
+	if err != nil {
+		diags.Add(config.SeverityError, path, fmt.Sprintf("target %s is not a valid url: %v", target, err))
+		return
+	}
+	if parsed.Scheme != "http" && parsed.Scheme != "https" {
+		diags.Add(config.SeverityError, path, fmt.Sprintf("target %s must use http or https", target))
+		return
+	}
+	if parsed.Hostname() == "" {
+		diags.Add(config.SeverityError, path, fmt.Sprintf("target %s has no host", target))
+	}
+}
+
+func checkSubnet(diags *config.Diagnostics, cfg config.Config, path string, subnet config.SubnetConfig) {
+	for i, target := range subnet.Targets {
+		checkTarget(diags, fmt.Sprintf("%s.targets[%d]", path, i), target)
+	}
+	ip, ipNet, err := net.ParseCIDR(subnet.CIDR)
+	if err != nil || ip.To4() == nil {
+		return
+	}
+	ipNet.IP = ip.To4()
+	if maskSize, _ := ipNet.Mask.Size(); maskSize >= 31 {
+		diags.Add(config.SeverityError, path+".cidr", fmt.Sprintf("subnet %s too small for host allocation", subnet.CIDR))
+		return
+	}
+	excludes := make([]net.IP, 0, len(subnet.ExcludeHosts))
+	seen := make(map[string]struct{}, len(subnet.ExcludeHosts))
+	for i, host := range subnet.ExcludeHosts {
+		hostPath := fmt.Sprintf("%s.excludeHosts[%d]", path, i)
+		hostIP := net.ParseIP(host).To4()
+		if hostIP == nil {
+			continue
+		}
+		if !ipNet.Contains(hostIP) {
+			diags.Add(config.SeverityError, hostPath, fmt.Sprintf("subnet %s exclude host %s outside subnet", subnet.CIDR, host))
+			continue
+		}
+		if _, ok := seen[hostIP.String()]; ok {
+			diags.Add(config.SeverityWarning, hostPath, fmt.Sprintf("subnet %s excludes %s more than once", subnet.CIDR, host))
+			continue
+		}
+		seen[hostIP.String()] = struct{}{}
+		excludes = append(excludes, hostIP)
+	}
+	for i, host := range subnet.Sampling.Canaries {
+		hostIP := net.ParseIP(host).To4()
+		if hostIP != nil && !ipNet.Contains(hostIP) {
+			diags.Add(config.SeverityError, fmt.Sprintf("%s.sampling.canaries[%d]", path, i), fmt.Sprintf("subnet %s canary %s outside subnet", subnet.CIDR, host))
+		}
+	}
+	pool, err := subnets.NewHostPool(ipNet, excludes)
+	if err != nil {
+		diags.Add(config.SeverityError, path, fmt.Sprintf("subnet %s: %v", subnet.CIDR, err))
+		return
+	}
+	count, countPath := cfg.IPsPerSubnet, path
+	if subnet.IPsPerSubnet > 0 {
+		count, countPath = subnet.IPsPerSubnet, path+".ipsPerSubnet"
+	}
+	if pool.Size() == 0 {
+		diags.Add(config.SeverityError, path, fmt.Sprintf("subnet %s has no available hosts after exclusions", subnet.CIDR))
+	} else if count > pool.Size() {
+		diags.Add(config.SeverityError, countPath, fmt.Sprintf("subnet %s has %d available hosts but ipsPerSubnet is %d", subnet.CIDR, pool.Size(), count))
+	}
+}
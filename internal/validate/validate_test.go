@@ -0,0 +1,63 @@
+package validate
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/thealonlevi/subnet-sentinel/internal/config"
+)
+
+func TestRunReportsAllProblemsWithLines(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	content := `subnets:
+  - cidr: 10.0.0.0/29
+    excludeHosts: [10.0.1.5]
+    ipsPerSubnet: 9
+  - cidr: 10.0.0.0/24
+targets:
+  - ftp://example.test
+intervalSecond: 5
+`
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	diags := Run(path, config.LoadOptions{})
+	expected := map[string]int{
+		"subnets[0].excludeHosts[0]": 3,
+		"subnets[0].ipsPerSubnet":    4,
+		"subnets[1].cidr":            5,
+		"targets[0]":                 7,
+		"intervalSecond":             8,
+	}
+	if len(diags.Items) != len(expected) {
+		t.Fatalf("expected %d diagnostics, got %v", len(expected), diags.Items)
+	}
+	for _, item := range diags.Items {
+		line, ok := expected[item.Path]
+		if !ok {
+			t.Fatalf("unexpected diagnostic %s", item)
+		}
+		severity := config.SeverityError
+		if item.Path == "subnets[1].cidr" {
+			severity = config.SeverityWarning
+		}
+		if item.Line != line || item.File != path || item.Severity != severity {
+			t.Fatalf("diagnostic %s: expected line %d", item, line)
+		}
+	}
+	if diags.Count(config.SeverityError) != len(expected)-1 {
+		t.Fatalf("expected %d errors", len(expected)-1)
+	}
+}
+
+func TestRunAcceptsValidConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("subnets:\n  - cidr: 10.0.0.0/24\n"), 0o644); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	if diags := Run(path, config.LoadOptions{}); len(diags.Items) != 0 {
+		t.Fatalf("expected no diagnostics, got %v", diags.Items)
+	}
+}